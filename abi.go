@@ -0,0 +1,117 @@
+package struc
+
+import (
+	"reflect"
+)
+
+// ABI selects the C struct layout rules applied by Options.CABI.
+type ABI int
+
+const (
+	ABINone  ABI = iota // packed, with no alignment padding
+	ABIAmd64            // x86-64 System V
+	ABI386              // i386 System V
+	ABIArm              // 32-bit ARM EABI
+	ABIArm64            // AArch64
+)
+
+// ptrSize returns the pointer size of the ABI in bits.
+func (a ABI) ptrSize() int {
+	switch a {
+	case ABIAmd64, ABIArm64:
+		return 64
+	}
+	return 32
+}
+
+// alignOf returns the alignment of a scalar of size bytes.
+func (a ABI) alignOf(size int) int {
+	if size == 8 && a == ABI386 {
+		// i386 aligns int64 and double struct members to 4 bytes
+		return 4
+	}
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+func alignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
+
+// align returns the alignment of a field under options.CABI, or its align=
+// tag if that is larger. Strings, pads, varints and Custom types are byte
+// aligned.
+func (f *Field) align(options *Options) int {
+	return f.alignIn(options, nil)
+}
+
+// alignIn is align for a field of the structs in open, whose alignment is
+// being computed. A recursive struct adds nothing to its own alignment.
+func (f *Field) alignIn(options *Options, open map[**Field]bool) int {
+	if a := f.naturalAlign(options, open); a > f.alignment {
+		return a
+	}
+	return f.alignment
+}
+
+func (f *Field) naturalAlign(options *Options, open map[**Field]bool) int {
+	abi := options.CABI
+	if g := f.bitGroup; g != nil {
+		if g.unit == 0 {
+			return 1
+		}
+		return abi.alignOf(g.size)
+	}
+	typ := f.Type.Resolve(options)
+	switch typ {
+	case Struct:
+		return f.Fields.alignIn(options, open)
+	case UnionType:
+		// like a C union of every registered case
+		align := 1
+		if cases := unionLookup(f.unionType); cases != nil {
+			for _, c := range cases.types {
+				if fields, err := parseFields(reflect.New(c.typ)); err == nil {
+					if a := fields.alignIn(options, open); a > align {
+						align = a
+					}
+				}
+			}
+		}
+		return align
+	case Bool, Int8, Uint8, Int16, Uint16, Int32, Uint32, Int64, Uint64, Float32, Float64:
+		return abi.alignOf(typ.Size())
+	}
+	return 1
+}
+
+// align returns the alignment of a struct under options.CABI: that of its
+// most aligned field.
+func (f Fields) align(options *Options) int {
+	return f.alignIn(options, nil)
+}
+
+func (f Fields) alignIn(options *Options, open map[**Field]bool) int {
+	align := 1
+	if len(f) == 0 || open[&f[0]] {
+		return align
+	}
+	if open == nil {
+		open = make(map[**Field]bool)
+	}
+	open[&f[0]] = true
+	defer delete(open, &f[0])
+	for _, field := range f {
+		if field != nil {
+			if a := field.alignIn(options, open); a > align {
+				align = a
+			}
+		}
+	}
+	return align
+}
@@ -0,0 +1,163 @@
+package struc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type abiInner struct {
+	X int8
+	Y int32
+}
+
+type abiExample struct {
+	A     int8
+	B     int64
+	C     int16
+	Inner abiInner
+	D     uint8
+	Flags uint16 `struc:"uint16:4"`
+	Mode  uint16 `struc:"uint16:12"`
+	E     [3]int8
+	F     float64
+}
+
+var abiOffsets = map[ABI][]int{
+	ABIAmd64: {0, 8, 16, 20, 28, 30, 30, 32, 40},
+	ABIArm64: {0, 8, 16, 20, 28, 30, 30, 32, 40},
+	ABIArm:   {0, 8, 16, 20, 28, 30, 30, 32, 40},
+	ABI386:   {0, 4, 12, 16, 24, 26, 26, 28, 32},
+}
+
+var abiSizes = map[ABI]int{ABIAmd64: 48, ABIArm64: 48, ABIArm: 48, ABI386: 40}
+
+func TestCABILayout(t *testing.T) {
+	for abi, offsets := range abiOffsets {
+		options := &Options{CABI: abi}
+		schema, err := Layout((*abiExample)(nil), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema.Size != abiSizes[abi] {
+			t.Errorf("ABI %d: size %d, want %d", abi, schema.Size, abiSizes[abi])
+		}
+		var got []int
+		for _, f := range schema.Fields {
+			got = append(got, f.Offset)
+		}
+		if !reflect.DeepEqual(got, offsets) {
+			t.Errorf("ABI %d: offsets %v, want %v", abi, got, offsets)
+		}
+		size, err := SizeofWithOptions(&abiExample{}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != abiSizes[abi] {
+			t.Errorf("ABI %d: Sizeof %d, want %d", abi, size, abiSizes[abi])
+		}
+	}
+}
+
+func TestCABIRoundTrip(t *testing.T) {
+	in := &abiExample{
+		A: 1, B: 2, C: 3, Inner: abiInner{4, 5}, D: 6,
+		Flags: 7, Mode: 8, E: [3]int8{9, 10, 11}, F: 12.5,
+	}
+	for _, abi := range []ABI{ABIAmd64, ABI386} {
+		options := &Options{CABI: abi}
+		var buf bytes.Buffer
+		if err := PackWithOptions(&buf, in, options); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != abiSizes[abi] {
+			t.Fatalf("ABI %d: packed %d bytes, want %d", abi, buf.Len(), abiSizes[abi])
+		}
+		// padding after A is zeroed
+		offsets := abiOffsets[abi]
+		if pad := buf.Bytes()[1:offsets[1]]; !bytes.Equal(pad, make([]byte, len(pad))) {
+			t.Errorf("ABI %d: padding %x", abi, pad)
+		}
+		out := &abiExample{}
+		if err := UnpackWithOptions(&buf, out, options); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("ABI %d: got %+v, want %+v", abi, out, in)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("ABI %d: %d bytes left after unpack", abi, buf.Len())
+		}
+	}
+}
+
+func TestCABITrailingPadding(t *testing.T) {
+	type tail struct {
+		A int32
+		B int8
+	}
+	type outer struct {
+		T [2]tail
+		C int8
+	}
+	options := &Options{CABI: ABIAmd64}
+	size, err := SizeofWithOptions(&outer{}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 20 {
+		t.Fatalf("size %d, want 20", size)
+	}
+	// trailing padding is required when unpacking
+	buf := make([]byte, 17)
+	if _, err := UnpackBytesWithOptions(buf, &outer{}, options); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unpacking a short struct: %v", err)
+	}
+	if _, err := PackIntoWithOptions(buf, &outer{}, options); err != io.ErrShortBuffer {
+		t.Fatalf("packing into a short buffer: %v", err)
+	}
+}
+
+func TestCABIInvalid(t *testing.T) {
+	for _, options := range []*Options{
+		{CABI: ABIArm64 + 1},
+		{CABI: ABIAmd64, ByteAlign: 4},
+	} {
+		if _, err := SizeofWithOptions(&abiExample{}, options); err == nil {
+			t.Errorf("%+v: expected error", options)
+		}
+	}
+}
+
+// TestCABICompiler checks the layout against the host C compiler.
+func TestCABICompiler(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("not amd64")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	var buf bytes.Buffer
+	if err := WriteCHeader(&buf, &Options{CABI: ABIAmd64}, (*abiExample)(nil)); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "struc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "test.c")
+	if err := ioutil.WriteFile(src, append(buf.Bytes(), "int main(void) { return 0; }\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(cc, "-std=c11", "-Wall", "-Werror", "-o", filepath.Join(dir, "test"), src).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s\n%s", err, out, buf.Bytes())
+	}
+}
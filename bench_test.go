@@ -201,3 +201,45 @@ func BenchmarkFullDecode(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkPackInto(b *testing.B) {
+	buf := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		if _, err := PackInto(buf, benchStrucRef); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnpackBytes(b *testing.B) {
+	var out BenchStrucExample
+	buf := make([]byte, 64)
+	n, err := PackInto(buf, benchStrucRef)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf = buf[:n]
+	for i := 0; i < b.N; i++ {
+		if _, err := UnpackBytes(buf, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	var out BenchStrucExample
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, nil)
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(benchStrucRef); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	dec := NewDecoder(&buf, nil)
+	for i := 0; i < b.N; i++ {
+		if err := dec.Decode(&out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package struc
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 	"reflect"
 )
@@ -26,11 +27,15 @@ func (b byteWriter) Write(p []byte) (int, error) {
 type binaryFallback reflect.Value
 
 func (b binaryFallback) String() string {
-	return b.String()
+	return reflect.Value(b).String()
 }
 
-func (b binaryFallback) Sizeof(val reflect.Value, options *Options) int {
-	return binary.Size(val.Interface())
+func (b binaryFallback) Sizeof(val reflect.Value, options *Options) (int, error) {
+	size := binary.Size(val.Interface())
+	if size < 0 {
+		return 0, fmt.Errorf("struc: cannot pack value of type %v", val.Type())
+	}
+	return size, nil
 }
 
 func (b binaryFallback) Pack(buf []byte, val reflect.Value, options *Options) (int, error) {
@@ -0,0 +1,196 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// bitGroup is a run of consecutive bitfields sharing one storage unit.
+// Typed bitfields ("uint16:4") share a unit of that type, while untyped
+// bitfields ("bits=4") are packed into as few whole bytes as possible.
+type bitGroup struct {
+	unit   int // storage unit in bits, 0 for untyped runs
+	size   int // storage size in bytes
+	used   int
+	lsb    bool
+	fields []*Field
+}
+
+func (f *Field) setBits(tag *strucTag) error {
+	bits, err := strconv.Atoi(tag.Bits)
+	if err != nil || bits < 1 || bits > 64 {
+		return fmt.Errorf("field `%s` has invalid bit width `%s`", f.Name, tag.Bits)
+	}
+	if f.Slice || f.Ptr {
+		return fmt.Errorf("bitfield `%s` cannot be an array, slice or pointer", f.Name)
+	}
+	if tag.Sizeof != "" {
+		return fmt.Errorf("bitfield `%s` cannot be a sizeof field", f.Name)
+	}
+	if tag.If != "" {
+		return fmt.Errorf("bitfield `%s` cannot be conditional", f.Name)
+	}
+	switch f.kind {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return fmt.Errorf("bitfield `%s` must be a bool or integer, not %s", f.Name, f.kind)
+	}
+	switch f.Type {
+	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
+	default:
+		return fmt.Errorf("bitfield `%s` cannot use type %s", f.Name, f.Type)
+	}
+	if tag.Type != "" {
+		f.bitUnit = f.Type.Size() * 8
+		if bits > f.bitUnit {
+			return fmt.Errorf("bitfield `%s` is wider than its %s storage", f.Name, f.Type)
+		}
+	}
+	f.bits = bits
+	f.lsb = tag.Lsb
+	return nil
+}
+
+// groupBits assigns consecutive bitfields to shared storage units,
+// starting a new unit whenever the next bitfield doesn't fit or is placed
+// with align= or offset=.
+func (f Fields) groupBits() {
+	var group *bitGroup
+	for _, field := range f {
+		if field == nil {
+			continue
+		}
+		if field.bits == 0 {
+			group = nil
+			continue
+		}
+		capacity := field.bitUnit
+		if capacity == 0 {
+			capacity = 64
+		}
+		if group == nil || group.unit != field.bitUnit || group.lsb != field.lsb ||
+			field.alignment > 0 || field.offset >= 0 ||
+			group.used+field.bits > capacity ||
+			(group.unit > 0 && group.fields[0].Order != field.Order) {
+			group = &bitGroup{unit: field.bitUnit, lsb: field.lsb}
+		}
+		field.bitStart = group.used
+		field.bitGroup = group
+		group.fields = append(group.fields, field)
+		group.used += field.bits
+		if group.unit > 0 {
+			group.size = group.unit / 8
+		} else {
+			group.size = (group.used + 7) / 8
+		}
+	}
+}
+
+func (g *bitGroup) shift(field *Field) uint {
+	if g.lsb {
+		return uint(field.bitStart)
+	}
+	return uint(g.size*8 - field.bitStart - field.bits)
+}
+
+func (g *bitGroup) order(options *Options) binary.ByteOrder {
+	if g.unit == 0 {
+		if g.lsb {
+			return binary.LittleEndian
+		}
+		return binary.BigEndian
+	}
+	if options.Order != nil {
+		return options.Order
+	}
+	return g.fields[0].Order
+}
+
+func bitMask(bits int) uint64 {
+	if bits >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(bits) - 1
+}
+
+func (g *bitGroup) Pack(buf []byte, val reflect.Value, options *Options) (int, error) {
+	var n uint64
+	for _, field := range g.fields {
+		v := val.Field(field.Index)
+		var x uint64
+		switch field.kind {
+		case reflect.Bool:
+			if v.Bool() {
+				x = 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x = uint64(v.Int())
+		default:
+			x = v.Uint()
+		}
+		n |= (x & bitMask(field.bits)) << g.shift(field)
+	}
+	order := g.order(options)
+	switch {
+	case g.size == 2 && g.unit > 0:
+		order.PutUint16(buf, uint16(n))
+	case g.size == 4 && g.unit > 0:
+		order.PutUint32(buf, uint32(n))
+	case g.size == 8 && g.unit > 0:
+		order.PutUint64(buf, n)
+	default:
+		for i := 0; i < g.size; i++ {
+			if order == binary.LittleEndian {
+				buf[i] = byte(n >> uint(8*i))
+			} else {
+				buf[i] = byte(n >> uint(8*(g.size-1-i)))
+			}
+		}
+	}
+	return g.size, nil
+}
+
+func (g *bitGroup) Unpack(buf []byte, val reflect.Value, options *Options) error {
+	var n uint64
+	order := g.order(options)
+	switch {
+	case g.size == 2 && g.unit > 0:
+		n = uint64(order.Uint16(buf))
+	case g.size == 4 && g.unit > 0:
+		n = uint64(order.Uint32(buf))
+	case g.size == 8 && g.unit > 0:
+		n = order.Uint64(buf)
+	default:
+		for i := 0; i < g.size; i++ {
+			if order == binary.LittleEndian {
+				n |= uint64(buf[i]) << uint(8*i)
+			} else {
+				n |= uint64(buf[i]) << uint(8*(g.size-1-i))
+			}
+		}
+	}
+	for _, field := range g.fields {
+		mask := bitMask(field.bits)
+		x := (n >> g.shift(field)) & mask
+		v := val.Field(field.Index)
+		switch field.kind {
+		case reflect.Bool:
+			v.SetBool(x != 0)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			switch field.Type {
+			case Int8, Int16, Int32, Int64:
+				// sign extend
+				if x&(1<<uint(field.bits-1)) != 0 {
+					x |= ^mask
+				}
+			}
+			v.SetInt(int64(x))
+		default:
+			v.SetUint(x)
+		}
+	}
+	return nil
+}
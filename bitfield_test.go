@@ -0,0 +1,122 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type bitfieldIPv4 struct {
+	Version  int  `struc:"uint8:4"`
+	IHL      int  `struc:"uint8:4"`
+	DSCP     int  `struc:"uint8:6"`
+	ECN      int  `struc:"uint8:2"`
+	Length   int  `struc:"uint16"`
+	Ident    int  `struc:"uint16"`
+	Reserved bool `struc:"uint16:1"`
+	DF       bool `struc:"uint16:1"`
+	MF       bool `struc:"uint16:1"`
+	Offset   int  `struc:"uint16:13"`
+}
+
+var bitfieldIPv4Ref = &bitfieldIPv4{
+	Version: 4, IHL: 5, DSCP: 0x2e, ECN: 1,
+	Length: 60, Ident: 0x1234, DF: true, Offset: 0x123,
+}
+
+var bitfieldIPv4Bytes = []byte{0x45, 0xb9, 0, 60, 0x12, 0x34, 0x41, 0x23}
+
+type bitfieldRun struct {
+	A uint8 `struc:"bits=3"`
+	B uint8 `struc:"bits=7"`
+	C int16 `struc:"bits=4"`
+	D uint16
+}
+
+type bitfieldLsb struct {
+	A uint8 `struc:"bits=3,lsb"`
+	B uint8 `struc:"bits=7,lsb"`
+	C int8  `struc:"int8:4,lsb"`
+	D int8  `struc:"int8:4,lsb"`
+}
+
+func TestBitfieldEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, bitfieldIPv4Ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bitfieldIPv4Bytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), bitfieldIPv4Bytes)
+	}
+	out := &bitfieldIPv4{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, bitfieldIPv4Ref) {
+		t.Fatalf("got: %#v\nwant: %#v", out, bitfieldIPv4Ref)
+	}
+}
+
+func TestBitfieldRun(t *testing.T) {
+	ref := &bitfieldRun{A: 5, B: 0x55, C: -3, D: 0xbeef}
+	// 101 1010101 1101 00 -> 1011 0101 0111 0100
+	refBytes := []byte{0xb5, 0x74, 0xbe, 0xef}
+	size, err := Sizeof(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(refBytes) {
+		t.Fatalf("sizeof failed; expected %d, got %d", len(refBytes), size)
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &bitfieldRun{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, ref) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+func TestBitfieldLsb(t *testing.T) {
+	ref := &bitfieldLsb{A: 5, B: 0x55, C: -2, D: 3}
+	// A in bits 0-2, B in bits 3-9 of a little-endian run
+	refBytes := []byte{0xad, 0x02, 0x3e}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &bitfieldLsb{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, ref) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+type bitfieldTooWide struct {
+	A int `struc:"uint8:9"`
+}
+
+type bitfieldSlice struct {
+	A []int `struc:"[2]uint8:3"`
+}
+
+func TestBitfieldParseErrors(t *testing.T) {
+	if err := parseTest(&bitfieldTooWide{}); err == nil {
+		t.Fatal("failed to error on bitfield wider than its storage")
+	}
+	if err := parseTest(&bitfieldSlice{}); err == nil {
+		t.Fatal("failed to error on bitfield array")
+	}
+}
@@ -0,0 +1,348 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// WriteCHeader writes C declarations matching the packed layout of each
+// struct type in types, which may be given as values or nil pointers as with
+// Layout. Nested struct types are declared first. The structs are declared
+// inside #pragma pack(1) with stdint.h types, or with natural alignment if
+// Options.CABI is set, and their sizes are checked with static_assert. Field
+// names are converted to snake_case.
+//
+// A slice whose length comes from another field becomes a flexible array
+// member, so it must be the last field. Fields C can't express, such as
+// varints, unions, Custom types and conditional fields, are errors.
+func WriteCHeader(w io.Writer, options *Options, types ...interface{}) error {
+	if options == nil {
+		options = emptyOptions
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if options.ByteAlign != 0 {
+		return fmt.Errorf("struc: WriteCHeader does not support Options.ByteAlign")
+	}
+	h := &cHeader{
+		options: options,
+		done:    make(map[reflect.Type]bool),
+		open:    make(map[reflect.Type]bool),
+		names:   make(map[string]reflect.Type),
+	}
+	for _, v := range types {
+		t := reflect.TypeOf(v)
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return fmt.Errorf("struc: WriteCHeader of %T, not a struct", v)
+		}
+		if err := h.declare(t); err != nil {
+			return err
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString("#include <assert.h>\n#include <stdint.h>\n")
+	if options.CABI == ABINone {
+		out.WriteString("\n#pragma pack(push, 1)\n")
+	}
+	out.Write(h.buf.Bytes())
+	if options.CABI == ABINone {
+		out.WriteString("\n#pragma pack(pop)\n")
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+type cHeader struct {
+	options *Options
+	buf     bytes.Buffer
+	done    map[reflect.Type]bool
+	open    map[reflect.Type]bool // types being declared
+	names   map[string]reflect.Type
+}
+
+// cField is one line of a C struct declaration.
+type cField struct {
+	decl, comment string
+	order         binary.ByteOrder // for multi-byte fields
+}
+
+var cTypes = map[Type]string{
+	Bool:    "uint8_t",
+	Int8:    "int8_t",
+	Uint8:   "uint8_t",
+	Int16:   "int16_t",
+	Uint16:  "uint16_t",
+	Int32:   "int32_t",
+	Uint32:  "uint32_t",
+	Int64:   "int64_t",
+	Uint64:  "uint64_t",
+	Float32: "float",
+	Float64: "double",
+	Pad:     "uint8_t",
+}
+
+func (h *cHeader) declare(t reflect.Type) error {
+	if h.done[t] {
+		return nil
+	}
+	if t.Name() == "" {
+		return fmt.Errorf("struc: WriteCHeader of anonymous struct %v", t)
+	}
+	if prev, ok := h.names[t.Name()]; ok {
+		return fmt.Errorf("struc: WriteCHeader of %v and %v, which have the same name", prev, t)
+	}
+	h.done[t] = true
+	h.open[t] = true
+	defer delete(h.open, t)
+	h.names[t.Name()] = t
+	fields, err := parseFields(reflect.New(t))
+	if err != nil {
+		return err
+	}
+	for i, f := range fields {
+		if f != nil && f.Type == Struct {
+			elem := structElem(t.Field(i).Type)
+			if h.open[elem] {
+				return fieldError(fmt.Errorf("recursive struct %v can't be expressed in C", elem), t, f.Name, -1, false)
+			}
+			if err := h.declare(elem); err != nil {
+				return err
+			}
+		}
+	}
+	last := -1
+	for i, f := range fields {
+		if f != nil {
+			last = i
+		}
+	}
+	schema, err := Layout(reflect.Zero(reflect.PtrTo(t)).Interface(), h.options)
+	if err != nil {
+		return err
+	}
+	var lines []cField
+	pads, end, k := 0, 0, 0
+	for i, f := range fields {
+		if f == nil {
+			continue
+		}
+		fl := schema.Fields[k]
+		k++
+		if f.alignment > 0 || f.offset >= 0 {
+			// the gap before the field becomes an explicit pad array
+			if h.options.CABI != ABINone {
+				return fieldError(fmt.Errorf("align= and offset= can't be expressed in C with Options.CABI"), t, f.Name, -1, false)
+			}
+			if fl.Offset == Dynamic || end == Dynamic {
+				return fieldError(fmt.Errorf("field after a variable-length field can't be placed in C"), t, f.Name, -1, false)
+			}
+			if fl.Offset > end {
+				lines = append(lines, cField{decl: fmt.Sprintf("uint8_t _pad%d[%d]", pads, fl.Offset-end)})
+				pads++
+			}
+		}
+		line, err := h.field(t, f, i == last, &pads)
+		if err != nil {
+			return fieldError(err, t, f.Name, -1, false)
+		}
+		if line.decl != "" {
+			lines = append(lines, line)
+			end = addOffset(fl.Offset, fl.Size)
+		}
+	}
+	size := schema.Size
+	if size == Dynamic {
+		// sizeof stops at the flexible array member
+		size = schema.Fields[len(schema.Fields)-1].Offset
+		size += fields.padding(size, h.options)
+	}
+
+	// byte order comments are per struct unless the fields differ
+	var order binary.ByteOrder
+	mixed := false
+	for _, l := range lines {
+		if l.order != nil {
+			if order != nil && l.order != order {
+				mixed = true
+			}
+			order = l.order
+		}
+	}
+	fmt.Fprintf(&h.buf, "\n")
+	if order != nil && !mixed {
+		fmt.Fprintf(&h.buf, "/* %s: fields are %s. */\n", t.Name(), orderName(order))
+	}
+	fmt.Fprintf(&h.buf, "struct %s {\n", t.Name())
+	for _, l := range lines {
+		comment := l.comment
+		if mixed && l.order != nil {
+			comment = strings.TrimPrefix(comment+", "+orderName(l.order), ", ")
+		}
+		if comment != "" {
+			fmt.Fprintf(&h.buf, "\t%s; /* %s */\n", l.decl, comment)
+		} else {
+			fmt.Fprintf(&h.buf, "\t%s;\n", l.decl)
+		}
+	}
+	fmt.Fprintf(&h.buf, "};\n")
+	if size != Dynamic {
+		fmt.Fprintf(&h.buf, "static_assert(sizeof(struct %s) == %d, \"struct %s must be %d bytes\");\n", t.Name(), size, t.Name(), size)
+	}
+	return nil
+}
+
+// structElem returns the struct type of a struct field, which may be a
+// pointer, array or slice.
+func structElem(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+func orderName(order binary.ByteOrder) string {
+	if order == binary.LittleEndian {
+		return "little-endian"
+	}
+	return "big-endian"
+}
+
+func (h *cHeader) field(t reflect.Type, f *Field, last bool, pads *int) (cField, error) {
+	var line cField
+	if f.cond != nil {
+		return line, fmt.Errorf("conditional fields can't be expressed in C")
+	}
+	sf := t.Field(f.Index)
+	name := cName(sf.Name)
+	if g := f.bitGroup; g != nil {
+		if g.fields[0] != f {
+			return line, nil
+		}
+		return h.bitfields(g)
+	}
+	order := f.Order
+	if h.options.Order != nil {
+		order = h.options.Order
+	}
+	typ := f.Type.Resolve(h.options)
+	var ctype string
+	switch {
+	case typ == Struct:
+		ctype = "struct " + structElem(sf.Type).Name()
+	case typ == String || typ == CString || typ == Uint8 && f.kind == reflect.String:
+		ctype = "char"
+	case typ == Pad:
+		ctype = "uint8_t"
+		name = fmt.Sprintf("_pad%d", *pads)
+		*pads++
+	case cTypes[typ] != "":
+		ctype = cTypes[typ]
+		if typ.Size() > 1 {
+			line.order = order
+		}
+		if typ == Bool {
+			line.comment = "bool"
+		}
+	default:
+		return line, fmt.Errorf("%s fields can't be expressed in C", typ)
+	}
+	goType := sf.Type
+	if f.Ptr {
+		goType = goType.Elem()
+	}
+	l := layout{options: h.options}
+	length := l.length(f, goType)
+	if typ == CString && !f.Slice {
+		return line, fmt.Errorf("unsized cstring fields can't be expressed in C")
+	}
+	if typ == Pad {
+		length = f.Len
+	}
+	switch {
+	case length == 0:
+		line.decl = ctype + " " + name
+	case length != Dynamic:
+		line.decl = fmt.Sprintf("%s %s[%d]", ctype, name, length)
+	case f.Sizefrom != nil && last:
+		line.decl = fmt.Sprintf("%s %s[]", ctype, name)
+		what := ", length in "
+		if f.byteLen {
+			what = ", byte length in "
+		}
+		line.comment = strings.TrimPrefix(line.comment+what+cName(t.FieldByIndex(f.Sizefrom).Name), ", ")
+	case f.Sizefrom != nil:
+		return line, fmt.Errorf("variable-length field must be last to become a flexible array member")
+	default:
+		return line, fmt.Errorf("field with no fixed length can't be expressed in C")
+	}
+	return line, nil
+}
+
+// bitfields declares a bitfield group as one integer, with the bits of each
+// field in a comment, as C compilers don't agree on bitfield layout.
+func (h *cHeader) bitfields(g *bitGroup) (cField, error) {
+	var line cField
+	ctype, ok := map[int]string{1: "uint8_t", 2: "uint16_t", 4: "uint32_t", 8: "uint64_t"}[g.size]
+	if !ok {
+		return line, fmt.Errorf("%d byte bitfield storage can't be expressed in C", g.size)
+	}
+	var names, bits []string
+	for _, f := range g.fields {
+		name := cName(f.Name)
+		names = append(names, name)
+		shift := int(g.shift(f))
+		if f.bits == 1 {
+			bits = append(bits, fmt.Sprintf("%s: bit %d", name, shift))
+		} else {
+			bits = append(bits, fmt.Sprintf("%s: bits %d-%d", name, shift+f.bits-1, shift))
+		}
+	}
+	line.decl = ctype + " " + strings.Join(names, "_")
+	line.comment = strings.Join(bits, ", ")
+	if g.size > 1 {
+		line.order = g.order(h.options)
+	}
+	return line, nil
+}
+
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true,
+	"continue": true, "default": true, "do": true, "double": true, "else": true,
+	"enum": true, "extern": true, "float": true, "for": true, "goto": true,
+	"if": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "return": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true,
+	"volatile": true, "while": true, "bool": true,
+}
+
+// cName converts a Go field name to snake_case, so NumEntries becomes
+// num_entries and HTTPServer becomes http_server.
+func cName(name string) string {
+	runes := []rune(name)
+	var out []rune
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1])) && runes[i-1] != '_' {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	s := string(out)
+	if cKeywords[s] {
+		s += "_"
+	}
+	return s
+}
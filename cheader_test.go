@@ -0,0 +1,176 @@
+package struc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type cHeaderInner struct {
+	X int16
+	Y int16
+}
+
+type cHeaderExample struct {
+	Magic    [4]byte
+	Version  uint16 `struc:"little"`
+	Flags    uint8  `struc:"uint8:3"`
+	Mode     uint8  `struc:"uint8:5"`
+	Name     string `struc:"[8]byte"`
+	Label    string `struc:"[6]cstring"`
+	Valid    bool
+	Size     Size_t
+	Origin   cHeaderInner
+	Corners  [2]cHeaderInner
+	Reserved []byte `struc:"[2]pad"`
+	Ratio    float64
+	HTTPCode int32
+	Count    int `struc:"uint16,sizeof=Data"`
+	Data     []int32
+}
+
+const cHeaderWant = `#include <assert.h>
+#include <stdint.h>
+
+#pragma pack(push, 1)
+
+/* cHeaderInner: fields are big-endian. */
+struct cHeaderInner {
+	int16_t x;
+	int16_t y;
+};
+static_assert(sizeof(struct cHeaderInner) == 4, "struct cHeaderInner must be 4 bytes");
+
+struct cHeaderExample {
+	uint8_t magic[4];
+	uint16_t version; /* little-endian */
+	uint8_t flags_mode; /* flags: bits 7-5, mode: bits 4-0 */
+	char name[8];
+	char label[6];
+	uint8_t valid; /* bool */
+	uint32_t size; /* big-endian */
+	struct cHeaderInner origin;
+	struct cHeaderInner corners[2];
+	uint8_t _pad0[2];
+	double ratio; /* big-endian */
+	int32_t http_code; /* big-endian */
+	uint16_t count; /* big-endian */
+	int32_t data[]; /* length in count, big-endian */
+};
+static_assert(sizeof(struct cHeaderExample) == 54, "struct cHeaderExample must be 54 bytes");
+
+#pragma pack(pop)
+`
+
+func TestWriteCHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCHeader(&buf, nil, (*cHeaderExample)(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != cHeaderWant {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), cHeaderWant)
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir, err := ioutil.TempDir("", "struc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "test.c")
+	if err := ioutil.WriteFile(src, append(buf.Bytes(), "int main(void) { return 0; }\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(cc, "-std=c11", "-Wall", "-Werror", "-o", filepath.Join(dir, "test"), src).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+}
+
+func TestWriteCHeaderErrors(t *testing.T) {
+	type varint struct {
+		V int `struc:"uvarint"`
+	}
+	type middle struct {
+		N    int `struc:"uint8,sizeof=Data"`
+		Data []byte
+		Tail int32
+	}
+	type bareString struct {
+		S string
+	}
+	type cond struct {
+		A int8
+		B int8 `struc:"int8,if=A"`
+	}
+	tests := []struct {
+		v   interface{}
+		err string
+	}{
+		{varint{}, "uvarint fields"},
+		{middle{}, "must be last"},
+		{bareString{}, "no fixed length"},
+		{cond{}, "conditional"},
+		{3, "not a struct"},
+		{struct{ A int8 }{}, "anonymous struct"},
+		{treeNode{}, "recursive struct"},
+	}
+	for _, test := range tests {
+		err := WriteCHeader(ioutil.Discard, nil, test.v)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%T: expected error containing %q, got %v", test.v, test.err, err)
+		}
+	}
+	if err := WriteCHeader(ioutil.Discard, &Options{ByteAlign: 4}, cHeaderInner{}); err == nil {
+		t.Error("ByteAlign accepted")
+	}
+}
+
+type cHeaderPlaced struct {
+	A int8
+	B int32 `struc:"align=4"`
+	C int16 `struc:"offset=12"`
+}
+
+func TestWriteCHeaderPlaced(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCHeader(&buf, nil, cHeaderPlaced{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `struct cHeaderPlaced {
+	int8_t a;
+	uint8_t _pad0[3];
+	int32_t b;
+	uint8_t _pad1[4];
+	int16_t c;
+};
+static_assert(sizeof(struct cHeaderPlaced) == 14, "struct cHeaderPlaced must be 14 bytes");
+`
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if err := WriteCHeader(ioutil.Discard, &Options{CABI: ABIAmd64}, cHeaderPlaced{}); err == nil {
+		t.Error("align= accepted with CABI")
+	}
+}
+
+func TestCName(t *testing.T) {
+	tests := map[string]string{
+		"NumEntries": "num_entries",
+		"HTTPServer": "http_server",
+		"ID":         "id",
+		"Int":        "int_",
+		"A1B":        "a1_b",
+		"Snake_Case": "snake_case",
+	}
+	for name, want := range tests {
+		if got := cName(name); got != want {
+			t.Errorf("cName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
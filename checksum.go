@@ -0,0 +1,262 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A ChecksumError is returned by Unpack when a checksum= field doesn't match
+// the bytes it covers.
+type ChecksumError struct {
+	Algorithm string
+	Expected  uint64 // computed from the input
+	Actual    uint64 // stored in the input
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %#x, got %#x", e.Algorithm, e.Expected, e.Actual)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var checksumLock sync.RWMutex
+var checksums = map[string]func([]byte) uint64{
+	"crc32":        func(b []byte) uint64 { return uint64(crc32.ChecksumIEEE(b)) },
+	"crc32c":       func(b []byte) uint64 { return uint64(crc32.Checksum(b, castagnoli)) },
+	"crc16":        crc16(0xa001, 0, true),       // CRC-16/ARC
+	"crc16-modbus": crc16(0xa001, 0xffff, true),  // CRC-16/MODBUS
+	"crc16-ccitt":  crc16(0x1021, 0xffff, false), // CRC-16/CCITT-FALSE
+	"adler32":      func(b []byte) uint64 { return uint64(adler32.Checksum(b)) },
+	"inet":         inetChecksum,
+}
+
+// RegisterChecksum makes an algorithm available to checksum= tags under
+// name. sum returns the checksum of data, which is truncated to the size of
+// the checksum field. Algorithms must be registered before the structs using
+// them are first packed or unpacked.
+func RegisterChecksum(name string, sum func(data []byte) uint64) {
+	checksumLock.Lock()
+	defer checksumLock.Unlock()
+	checksums[name] = sum
+}
+
+func lookupChecksum(name string) func([]byte) uint64 {
+	checksumLock.RLock()
+	defer checksumLock.RUnlock()
+	return checksums[name]
+}
+
+func crc16(poly, init uint16, reflected bool) func([]byte) uint64 {
+	return func(data []byte) uint64 {
+		crc := init
+		for _, b := range data {
+			if reflected {
+				crc ^= uint16(b)
+				for i := 0; i < 8; i++ {
+					if crc&1 != 0 {
+						crc = crc>>1 ^ poly
+					} else {
+						crc >>= 1
+					}
+				}
+			} else {
+				crc ^= uint16(b) << 8
+				for i := 0; i < 8; i++ {
+					if crc&0x8000 != 0 {
+						crc = crc<<1 ^ poly
+					} else {
+						crc <<= 1
+					}
+				}
+			}
+		}
+		return uint64(crc)
+	}
+}
+
+// inetChecksum is the ones' complement sum of big-endian 16-bit words used
+// by IP, TCP and UDP (RFC 1071).
+func inetChecksum(data []byte) uint64 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return uint64(^uint16(sum))
+}
+
+// checksum describes a checksum= field covering fields from through to of
+// its struct.
+type checksum struct {
+	name     string
+	sum      func([]byte) uint64
+	from, to int
+}
+
+// setChecksum parses the checksum= and range= tags of field i of struct t.
+func (f *Field) setChecksum(t reflect.Type, i int, tag *strucTag) error {
+	if tag.Checksum == "" {
+		return fmt.Errorf("field `%s` has range= but no checksum=", f.Name)
+	}
+	switch f.Type {
+	case Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
+	default:
+		return fmt.Errorf("checksum= field `%s` must be a fixed-size integer", f.Name)
+	}
+	if f.Slice || f.Ptr || f.bits > 0 || !intKind(f.kind) || f.hasMagic() {
+		return fmt.Errorf("checksum= field `%s` must be a plain integer", f.Name)
+	}
+	c := &checksum{name: tag.Checksum, sum: lookupChecksum(tag.Checksum), from: 0, to: i - 1}
+	if c.sum == nil {
+		return fmt.Errorf("field `%s` has unknown checksum=%s", f.Name, tag.Checksum)
+	}
+	if tag.Range != "" {
+		names := strings.SplitN(tag.Range, ":", 2)
+		if len(names) == 1 {
+			names = append(names, names[0])
+		}
+		for j, name := range names {
+			field, ok := t.FieldByName(name)
+			if !ok || len(field.Index) > 1 {
+				return fmt.Errorf("`range=%s` field `%s` does not exist", tag.Range, name)
+			}
+			if j == 0 {
+				c.from = field.Index[0]
+			} else {
+				c.to = field.Index[0]
+			}
+		}
+	}
+	if c.from > c.to {
+		return fmt.Errorf("field `%s` has an empty checksum range", f.Name)
+	}
+	f.checksum = c
+	return nil
+}
+
+func (f Fields) hasChecksum() bool {
+	for _, field := range f {
+		if field != nil && field.checksum != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumSpans records the start and end offsets of each field, so checksum
+// ranges can be found after packing or unpacking the struct. Methods on a
+// nil *checksumSpans do nothing.
+type checksumSpans struct {
+	start, end []int
+}
+
+func newChecksumSpans(n int) *checksumSpans {
+	return &checksumSpans{start: make([]int, n), end: make([]int, n)}
+}
+
+func (s *checksumSpans) set(i, start, end int) {
+	if s != nil {
+		s.start[i], s.end[i] = start, end
+	}
+}
+
+func (s *checksumSpans) data(buf []byte, c *checksum) []byte {
+	return buf[s.start[c.from]:s.end[c.to]]
+}
+
+func checksumOrder(field *Field, options *Options) binary.ByteOrder {
+	if options.Order != nil {
+		return options.Order
+	}
+	return field.Order
+}
+
+func putChecksum(buf []byte, n uint64, order binary.ByteOrder) {
+	switch len(buf) {
+	case 1:
+		buf[0] = byte(n)
+	case 2:
+		order.PutUint16(buf, uint16(n))
+	case 4:
+		order.PutUint32(buf, uint32(n))
+	case 8:
+		order.PutUint64(buf, n)
+	}
+}
+
+func getChecksum(buf []byte, order binary.ByteOrder) uint64 {
+	switch len(buf) {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(order.Uint16(buf))
+	case 4:
+		return uint64(order.Uint32(buf))
+	case 8:
+		return order.Uint64(buf)
+	}
+	return 0
+}
+
+// writeChecksums fills in the checksum fields of a packed struct. They are
+// computed in field order, so a checksum covers the final value of earlier
+// checksum fields and zero for later ones, including itself.
+func (f Fields) writeChecksums(buf []byte, spans *checksumSpans, options *Options) {
+	for i, field := range f {
+		if field != nil && field.checksum != nil {
+			for j := spans.start[i]; j < spans.end[i]; j++ {
+				buf[j] = 0
+			}
+		}
+	}
+	for i, field := range f {
+		if field == nil || field.checksum == nil {
+			continue
+		}
+		sum := field.checksum.sum(spans.data(buf, field.checksum))
+		putChecksum(buf[spans.start[i]:spans.end[i]], sum, checksumOrder(field, options))
+	}
+}
+
+// verifyChecksums checks the checksum fields of an unpacked struct against
+// its raw bytes, starting at offset base of the input.
+func (f Fields) verifyChecksums(t reflect.Type, raw []byte, base int64, spans *checksumSpans, options *Options) error {
+	data := make([]byte, len(raw))
+	for i, field := range f {
+		if field == nil || field.checksum == nil || spans.start[i] == spans.end[i] {
+			continue
+		}
+		// recreate the bytes writeChecksums saw
+		copy(data, raw)
+		for j := i; j < len(f); j++ {
+			if f[j] != nil && f[j].checksum != nil {
+				for k := spans.start[j]; k < spans.end[j]; k++ {
+					data[k] = 0
+				}
+			}
+		}
+		order := checksumOrder(field, options)
+		stored := raw[spans.start[i]:spans.end[i]]
+		want := make([]byte, len(stored))
+		putChecksum(want, field.checksum.sum(spans.data(data, field.checksum)), order)
+		if string(want) != string(stored) {
+			err := &ChecksumError{
+				Algorithm: field.checksum.name,
+				Expected:  getChecksum(want, order),
+				Actual:    getChecksum(stored, order),
+			}
+			return fieldError(err, t, field.Name, base+int64(spans.start[i]), false)
+		}
+	}
+	return nil
+}
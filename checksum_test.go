@@ -0,0 +1,171 @@
+package struc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	check := []byte("123456789")
+	tests := map[string]uint64{
+		"crc32":        0xcbf43926,
+		"crc32c":       0xe3069283,
+		"crc16":        0xbb3d,
+		"crc16-modbus": 0x4b37,
+		"crc16-ccitt":  0x29b1,
+		"adler32":      0x091e01de,
+	}
+	for name, want := range tests {
+		if got := lookupChecksum(name)(check); got != want {
+			t.Errorf("%s: got %#x, want %#x", name, got, want)
+		}
+	}
+	ip := []byte{0x45, 0, 0, 0x73, 0, 0, 0x40, 0, 0x40, 0x11, 0, 0, 0xc0, 0xa8, 0, 1, 0xc0, 0xa8, 0, 0xc7}
+	if got := inetChecksum(ip); got != 0xb861 {
+		t.Errorf("inet: got %#x, want 0xb861", got)
+	}
+}
+
+type checksumFrame struct {
+	Kind    uint8
+	Len     int `struc:"uint16,sizeof=Payload"`
+	Payload []byte
+	CRC     uint32 `struc:"checksum=crc32"`
+}
+
+func TestChecksumTrailing(t *testing.T) {
+	in := &checksumFrame{Kind: 1, Payload: []byte("hello")}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	want := uint32(lookupChecksum("crc32")(data[:8]))
+	out := &checksumFrame{}
+	if err := Unpack(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.CRC != want || !bytes.Equal(out.Payload, in.Payload) {
+		t.Fatalf("got %+v, want CRC %#x", out, want)
+	}
+
+	data[4] ^= 1
+	err := Unpack(bytes.NewReader(data), &checksumFrame{})
+	var ce *ChecksumError
+	if !errors.As(err, &ce) || ce.Algorithm != "crc32" || ce.Actual != uint64(want) {
+		t.Fatalf("got %v", err)
+	}
+	if fe := err.(*FieldError); fe.Path != "CRC" || fe.Offset != 8 {
+		t.Fatalf("got %v", err)
+	}
+}
+
+type checksumIPv4 struct {
+	VersionIHL uint8
+	TOS        uint8
+	Length     uint16
+	ID         uint16
+	Frag       uint16
+	TTL        uint8
+	Protocol   uint8
+	Checksum   uint16 `struc:"checksum=inet,range=VersionIHL:Dst"`
+	Src        [4]byte
+	Dst        [4]byte
+}
+
+type checksumPacket struct {
+	Prefix uint8
+	IP     checksumIPv4
+}
+
+func TestChecksumInet(t *testing.T) {
+	// the checksum covers itself as zero, in a nested struct
+	in := &checksumPacket{7, checksumIPv4{
+		VersionIHL: 0x45, Length: 0x73, Frag: 0x4000, TTL: 0x40, Protocol: 0x11,
+		Src: [4]byte{192, 168, 0, 1}, Dst: [4]byte{192, 168, 0, 199},
+	}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Bytes()[11:13]; !bytes.Equal(got, []byte{0xb8, 0x61}) {
+		t.Fatalf("checksum % x", got)
+	}
+	out := &checksumPacket{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	in.IP.Checksum = 0xb861
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
+
+type checksumCustom struct {
+	A, B uint8
+	Sum  uint8 `struc:"checksum=test-sum8,range=A:B"`
+	C    uint8
+	All  uint16 `struc:"checksum=crc16"`
+}
+
+func TestChecksumRegister(t *testing.T) {
+	RegisterChecksum("test-sum8", func(data []byte) uint64 {
+		var sum uint64
+		for _, b := range data {
+			sum += uint64(b)
+		}
+		return sum
+	})
+	in := &checksumCustom{A: 200, B: 100, C: 3}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), buf.Bytes()...)
+	if data[2] != 44 {
+		t.Fatalf("sum8 %d", data[2])
+	}
+	// the later crc16 covers the final sum8
+	if crc := lookupChecksum("crc16")(data[:4]); data[4] != byte(crc>>8) || data[5] != byte(crc) {
+		t.Fatalf("crc16 % x, want %#x", data[4:], crc)
+	}
+	if _, err := UnpackBytes(data, &checksumCustom{}); err != nil {
+		t.Fatal(err)
+	}
+	data[2] = 0
+	if _, err := UnpackBytes(data, &checksumCustom{}); err == nil || !strings.Contains(err.Error(), "test-sum8 checksum mismatch") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestChecksumBad(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		err string
+	}{
+		{&struct {
+			A, B uint8 `struc:"checksum=nope"`
+		}{}, "unknown checksum=nope"},
+		{&struct {
+			A uint8 `struc:"checksum=crc32"`
+		}{}, "empty checksum range"},
+		{&struct {
+			A, B uint8 `struc:"checksum=crc32,range=X"`
+		}{}, "does not exist"},
+		{&struct {
+			A uint8
+			B string `struc:"checksum=crc32"`
+		}{}, "fixed-size integer"},
+		{&struct {
+			A, B uint8 `struc:"range=A"`
+		}{}, "no checksum="},
+	}
+	for _, test := range tests {
+		if _, err := Sizeof(test.v); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%T: expected error containing %q, got %v", test.v, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package example holds Go types generated by struc-cgen from example.h.
+package example
+
+//go:generate go run .. -package example -output example_cgen.go -order little example.h
@@ -0,0 +1,88 @@
+/* A made-up capture file format, used to test struc-cgen. */
+#ifndef EXAMPLE_H
+#define EXAMPLE_H
+
+#include <stdint.h>
+#include <stddef.h>
+
+#define EXAMPLE_MAGIC 0x43415054u /* "CAPT" */
+#define NAME_LEN      16
+#define MAX_CHANNELS  (1 << 2)
+#define EXAMPLE_STR   "not a number"
+#define MIN(a, b)     ((a) < (b) ? (a) : (b))
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+typedef uint16_t channel_id_t;
+
+enum link_type {
+	LINK_NONE,
+	LINK_ETHERNET = 1,
+	LINK_RAW = 101,
+	LINK_LAST
+};
+
+typedef enum {
+	COMPRESS_NONE,
+	COMPRESS_LZ4,
+} compress_t;
+
+struct channel {
+	channel_id_t id;
+	char name[NAME_LEN];
+	enum link_type link;
+	unsigned int enabled : 1;
+	unsigned int priority : 3;
+	unsigned int reserved : 28;
+};
+
+typedef struct {
+	uint32_t magic;
+	uint8_t version[2];
+	compress_t compression;
+	size_t snaplen;
+	off_t index_offset;
+	double start_time;
+	struct channel channels[MAX_CHANNELS];
+	struct {
+		int16_t minutes;
+		signed char dst;
+	} tz;
+} file_header_t;
+
+struct record {
+	uint64_t timestamp;
+	unsigned short channel;
+	uint32_t length;
+	uint8_t data[] __counted_by(length);
+};
+
+struct note {
+	uint8_t len;
+	char text[]; /* struc:sizefrom=len */
+};
+
+/* not convertible: pointers and unions */
+struct callback {
+	void (*fn)(void *arg);
+	void *arg;
+};
+
+struct uses_callback {
+	int32_t id;
+	struct callback cb;
+};
+
+int example_open(const char *path, struct record *out);
+
+static inline int example_version(void) {
+	return 1;
+}
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* EXAMPLE_H */
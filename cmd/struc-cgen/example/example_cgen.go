@@ -0,0 +1,71 @@
+// Code generated by struc-cgen from example.h; DO NOT EDIT.
+
+package example
+
+import "github.com/lunixbochs/struc"
+
+const (
+	ExampleMagic = 1128353876
+	NameLen      = 16
+	MaxChannels  = 4
+)
+
+// LinkType is C enum link_type.
+type LinkType int32
+
+const (
+	LinkNone     LinkType = 0
+	LinkEthernet LinkType = 1
+	LinkRaw      LinkType = 101
+	LinkLast     LinkType = 102
+)
+
+// Compress is C compress_t.
+type Compress int32
+
+const (
+	CompressNone Compress = 0
+	CompressLz4  Compress = 1
+)
+
+// Channel is C struct channel.
+type Channel struct {
+	Id       uint16   `struc:"little"`
+	Name     string   `struc:"[16]cstring"`
+	Link     LinkType `struc:"little"`
+	Enabled  uint32   `struc:"uint32:1,lsb,little"`
+	Priority uint32   `struc:"uint32:3,lsb,little"`
+	Reserved uint32   `struc:"uint32:28,lsb,little"`
+}
+
+// FileHeaderTz is C file_header_t.tz.
+type FileHeaderTz struct {
+	Minutes int16 `struc:"little"`
+	Dst     int8
+}
+
+// FileHeader is C file_header_t.
+type FileHeader struct {
+	Magic       uint32 `struc:"little"`
+	Version     [2]uint8
+	Compression Compress     `struc:"little"`
+	Snaplen     struc.Size_t `struc:"little"`
+	IndexOffset struc.Off_t  `struc:"little"`
+	StartTime   float64      `struc:"little"`
+	Channels    [4]Channel
+	Tz          FileHeaderTz
+}
+
+// Record is C struct record.
+type Record struct {
+	Timestamp uint64  `struc:"little"`
+	Channel   uint16  `struc:"little"`
+	Length    uint32  `struc:"little"`
+	Data      []uint8 `struc:"sizefrom=Length"`
+}
+
+// Note is C struct note.
+type Note struct {
+	Len  uint8
+	Text string `struc:"sizefrom=Len"`
+}
@@ -0,0 +1,75 @@
+package example
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/lunixbochs/struc"
+)
+
+func TestRecord(t *testing.T) {
+	ref := &Record{Timestamp: 1, Channel: 2, Length: 3, Data: []byte{4, 5, 6}}
+	want := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0,
+		2, 0,
+		3, 0, 0, 0,
+		4, 5, 6,
+	}
+	got, err := struc.AppendPack(nil, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var out Record
+	if err := struc.Unpack(bytes.NewReader(want), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, ref) {
+		t.Fatalf("got %+v, want %+v", out, ref)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	ref := &FileHeader{
+		Magic:       ExampleMagic,
+		Version:     [2]uint8{1, 2},
+		Compression: CompressLz4,
+		Snaplen:     65535,
+		IndexOffset: -1,
+		StartTime:   1.5,
+		Tz:          FileHeaderTz{Minutes: -60, Dst: 1},
+	}
+	ref.Channels[1] = Channel{Id: 7, Name: "eth0", Link: LinkEthernet, Enabled: 1, Priority: 5}
+	opt := &struc.Options{PtrSize: 64}
+	size, err := struc.SizeofWithOptions(ref, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 magic + 2 version + 4 compression + 8 snaplen + 8 offset + 8 time
+	// + 4 * (2 id + 16 name + 4 link + 4 bits) + 3 tz
+	if size != 34+4*26+3 {
+		t.Fatalf("size %d", size)
+	}
+	packed, err := struc.AppendPackWithOptions(nil, ref, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed[:4], []byte("TPAC")) {
+		t.Fatalf("magic is not little-endian: %v", packed[:4])
+	}
+	// enabled is bit 0 and priority bits 1-3 of a little-endian uint32
+	channel := packed[34+26:]
+	if !bytes.Equal(channel[22:26], []byte{0xb, 0, 0, 0}) {
+		t.Fatalf("bitfields packed as %v", channel[22:26])
+	}
+	var out FileHeader
+	if _, err := struc.UnpackBytesWithOptions(packed, &out, opt); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, ref) {
+		t.Fatalf("got %+v, want %+v", out, ref)
+	}
+}
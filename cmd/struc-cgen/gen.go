@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+type config struct {
+	pkg     string
+	sources []string // header names for the generated comment
+	order   string   // "little", "big" or "" for struc's default
+}
+
+type generator struct {
+	config
+	buf      bytes.Buffer
+	warnings []string
+	imports  bool // uses struc.Size_t or struc.Off_t
+}
+
+// generate converts the declarations in hdr to Go source. Structs that
+// can't be converted are left out with a warning.
+func generate(hdr *header, cfg config) ([]byte, []string, error) {
+	g := &generator{config: cfg}
+	for _, d := range hdr.decls {
+		if s, ok := d.(*cStruct); ok {
+			nameAnonymous(s)
+		}
+	}
+	g.checkNames(hdr)
+	var structs []*cStruct
+	for _, d := range hdr.decls {
+		if s, ok := d.(*cStruct); ok && s.goName != "" {
+			structs = append(structs, s)
+		}
+	}
+	// a struct is unusable if any struct it contains is
+	for changed := true; changed; {
+		changed = false
+		for _, s := range structs {
+			if s.err != nil {
+				continue
+			}
+			for _, f := range s.fields {
+				if st := f.typ.strct; st != nil && (st.err != nil || st.goName == "") {
+					s.err = g.fieldError(s, f, fmt.Errorf("uses %s, which is not supported", describe(st)))
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	g.writeDefines(&body, hdr.defines)
+	for _, d := range hdr.decls {
+		switch d := d.(type) {
+		case *cEnum:
+			g.writeEnum(&body, d)
+		case *cStruct:
+			if d.goName == "" {
+				continue
+			}
+			if d.err == nil {
+				d.err = g.writeStruct(&body, d)
+			}
+			if d.err != nil {
+				g.warnings = append(g.warnings, fmt.Sprintf("skipping %s: %v", d.cName, d.err))
+			}
+		}
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by struc-cgen from %s; DO NOT EDIT.\n\n", strings.Join(g.sources, ", "))
+	fmt.Fprintf(&g.buf, "package %s\n", g.pkg)
+	if g.imports {
+		fmt.Fprintf(&g.buf, "\nimport \"github.com/lunixbochs/struc\"\n")
+	}
+	g.buf.Write(body.Bytes())
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("formatting output: %v\n%s", err, g.buf.Bytes())
+	}
+	return src, g.warnings, nil
+}
+
+// nameAnonymous names an anonymous struct after its parent and the member
+// it declares.
+func nameAnonymous(s *cStruct) {
+	if s.parent == nil || s.goName != "" {
+		return
+	}
+	nameAnonymous(s.parent)
+	if s.parent.goName != "" {
+		s.cName = s.parent.cName + "." + s.member
+		s.goName = s.parent.goName + goName(s.member)
+	}
+}
+
+func describe(s *cStruct) string {
+	if s.cName == "" {
+		return "an anonymous struct"
+	}
+	return s.cName
+}
+
+func (g *generator) fieldError(s *cStruct, f *cField, err error) error {
+	return fmt.Errorf("line %d: field %s %v", f.line, f.cName, err)
+}
+
+// checkNames leaves out declarations whose Go names collide with earlier
+// ones.
+func (g *generator) checkNames(hdr *header) {
+	seen := make(map[string]string)
+	use := func(goName, cName string) bool {
+		if prev, ok := seen[goName]; ok {
+			g.warnings = append(g.warnings, fmt.Sprintf("skipping %s: Go name %s is already used by %s", cName, goName, prev))
+			return false
+		}
+		seen[goName] = cName
+		return true
+	}
+	var defines []*cConst
+	for _, c := range hdr.defines {
+		if use(c.goName, c.cName) {
+			defines = append(defines, c)
+		}
+	}
+	hdr.defines = defines
+	for _, d := range hdr.decls {
+		switch d := d.(type) {
+		case *cEnum:
+			if d.goName != "" && !use(d.goName, d.cName) {
+				d.goName = "int32"
+			}
+			var consts []*cConst
+			for _, c := range d.consts {
+				if use(c.goName, c.cName) {
+					consts = append(consts, c)
+				}
+			}
+			d.consts = consts
+		case *cStruct:
+			if d.goName != "" && d.err == nil {
+				if prev, ok := seen[d.goName]; ok {
+					d.err = fmt.Errorf("Go name %s is already used by %s", d.goName, prev)
+				} else {
+					seen[d.goName] = d.cName
+				}
+			}
+		}
+	}
+}
+
+func (g *generator) writeDefines(w *bytes.Buffer, defines []*cConst) {
+	if len(defines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nconst (\n")
+	for _, c := range defines {
+		fmt.Fprintf(w, "%s = %d\n", c.goName, c.value)
+	}
+	fmt.Fprintf(w, ")\n")
+}
+
+func (g *generator) writeEnum(w *bytes.Buffer, e *cEnum) {
+	typ := ""
+	if e.goName != "" && e.goName != "int32" {
+		typ = " " + e.goName
+		fmt.Fprintf(w, "\n// %s is C %s.\ntype %s int32\n", e.goName, e.cName, e.goName)
+	}
+	if len(e.consts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nconst (\n")
+	for _, c := range e.consts {
+		fmt.Fprintf(w, "%s%s = %d\n", c.goName, typ, c.value)
+	}
+	fmt.Fprintf(w, ")\n")
+}
+
+func (g *generator) writeStruct(w *bytes.Buffer, s *cStruct) error {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "\n// %s is C %s.\ntype %s struct {\n", s.goName, s.cName, s.goName)
+	names := make(map[string]bool)
+	// only a struct that is written can use the struc import
+	imports := false
+	for i, f := range s.fields {
+		if names[f.goName] {
+			return g.fieldError(s, f, fmt.Errorf("has the same Go name as another field"))
+		}
+		names[f.goName] = true
+		typ, tag, err := g.field(s, i, f)
+		if err != nil {
+			return g.fieldError(s, f, err)
+		}
+		if tag != "" {
+			tag = fmt.Sprintf(" `struc:\"%s\"`", tag)
+		}
+		fmt.Fprintf(&out, "%s %s%s\n", f.goName, typ, tag)
+		if f.typ.strucType == "size_t" || f.typ.strucType == "off_t" {
+			imports = true
+		}
+	}
+	fmt.Fprintf(&out, "}\n")
+	w.Write(out.Bytes())
+	g.imports = g.imports || imports
+	return nil
+}
+
+// field returns the Go type and struc tag for field i of s.
+func (g *generator) field(s *cStruct, i int, f *cField) (string, string, error) {
+	t := f.typ
+	goType := t.goType
+	if t.strct != nil {
+		goType = t.strct.goName
+	}
+	var tag []string
+	if len(f.dims) > 1 {
+		return "", "", fmt.Errorf("is a multidimensional array, which is not supported")
+	}
+	if f.countedBy != "" && (len(f.dims) == 0 || f.dims[0] != -1) {
+		return "", "", fmt.Errorf("has a count but is not a flexible array member")
+	}
+	switch {
+	case f.bits > 0:
+		if len(f.dims) > 0 || !t.integer && goType != "bool" || t.size == 0 || t.strct != nil {
+			return "", "", fmt.Errorf("is a bitfield of an unsupported type")
+		}
+		if f.bits > t.size*8 {
+			return "", "", fmt.Errorf("is wider than its type")
+		}
+		tag = append(tag, fmt.Sprintf("%s:%d", t.strucType, f.bits))
+		if g.order == "little" {
+			tag = append(tag, "lsb")
+		}
+	case len(f.dims) == 0:
+	case f.dims[0] >= 0:
+		n := f.dims[0]
+		if t.char {
+			goType = "string"
+			tag = append(tag, fmt.Sprintf("[%d]cstring", n))
+		} else {
+			if t.size == 0 && t.strct == nil {
+				tag = append(tag, fmt.Sprintf("[%d]%s", n, t.strucType))
+			}
+			goType = fmt.Sprintf("[%d]%s", n, goType)
+		}
+	default:
+		if i != len(s.fields)-1 {
+			return "", "", fmt.Errorf("is a flexible array member but not the last field")
+		}
+		count, err := g.count(s, i, f)
+		if err != nil {
+			return "", "", err
+		}
+		if t.char {
+			goType = "string"
+		} else {
+			if t.size == 0 && t.strct == nil {
+				tag = append(tag, "[]"+t.strucType)
+			}
+			goType = "[]" + goType
+		}
+		tag = append(tag, "sizefrom="+count)
+	}
+	if g.order != "" && t.size != 1 && t.strct == nil {
+		tag = append(tag, g.order)
+	}
+	return goType, strings.Join(tag, ","), nil
+}
+
+// count returns the Go name of the field holding the length of flexible
+// array member f.
+func (g *generator) count(s *cStruct, i int, f *cField) (string, error) {
+	if f.countedBy == "" {
+		return "", fmt.Errorf("is a flexible array member with no count; " +
+			"annotate it with __counted_by(field) or /* struc:sizefrom=field */")
+	}
+	for _, c := range s.fields[:i] {
+		if c.cName == f.countedBy {
+			if !c.typ.integer || len(c.dims) > 0 {
+				return "", fmt.Errorf("count %s is not an integer", c.cName)
+			}
+			return c.goName, nil
+		}
+	}
+	return "", fmt.Errorf("count %s is not an earlier field", f.countedBy)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	const out = "example/example_cgen.go"
+	src, warnings, err := convert([]string{"example/example.h"}, config{pkg: "example", order: "little"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Fatalf("%s is stale; run go generate ./cmd/struc-cgen/example", out)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "uses struct callback") {
+		t.Fatalf("unexpected warnings: %q", warnings)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := map[string]int64{
+		"1":               1,
+		"0x10u":           16,
+		"010":             8,
+		"1 + 2 * 3":       7,
+		"(1 + 2) * 3":     9,
+		"1 << 4 | 1":      17,
+		"-(2 - 5)":        3,
+		"~0 & 0xff":       255,
+		"(uint32_t)7 / 2": 3,
+		"'A'":             65,
+		"OTHER + 1":       43,
+	}
+	for expr, want := range tests {
+		p := newParser()
+		if err := p.parse("#define OTHER 42\n#define X " + expr + "\n"); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := p.consts["X"]; !ok || got != want {
+			t.Errorf("%s: got %d (%v), want %d", expr, got, ok, want)
+		}
+	}
+	p := newParser()
+	if err := p.parse("#define S \"str\"\n#define F(x) (x)\n#define E\n"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.consts) != 0 {
+		t.Errorf("non-integer macros became constants: %v", p.consts)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"num_entries":  "NumEntries",
+		"MAX_NAME_LEN": "MaxNameLen",
+		"_reserved":    "Reserved",
+		"ipAddr":       "IpAddr",
+		"2d":           "X2d",
+	}
+	for c, want := range tests {
+		if got := goName(c); got != want {
+			t.Errorf("goName(%q) = %q, want %q", c, got, want)
+		}
+	}
+	if got := goTypeName("file_header_t"); got != "FileHeader" {
+		t.Errorf("goTypeName = %q", got)
+	}
+}
+
+var unsupported = []struct {
+	src, warning string
+}{
+	{"struct s { int *p; };", "pointers"},
+	{"struct s { union { int a; } u; };", "unions"},
+	{"struct s { long double d; };", "unsupported type long double"},
+	{"struct s { int a[2][3]; };", "multidimensional"},
+	{"struct s { int n; char data[]; };", "no count"},
+	{"struct s { int n; char data[] __counted_by(m); };", "not an earlier field"},
+	{"struct s { int n[2]; char data[] __counted_by(n); };", "not an integer"},
+	{"struct s { int n; char data[0]; int x; } __attribute__((packed));", "not the last field"},
+	{"struct s { int n __counted_by(n); };", "not a flexible array member"},
+	{"struct s { float f : 3; };", "bitfield of an unsupported type"},
+	{"struct s { unknown_t x; };", "unknown type unknown_t"},
+	{"struct s { int a; int A; };", "same Go name"},
+	{"struct s { int a; };\nstruct S { int a; };", "already used by struct s"},
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, test := range unsupported {
+		p := newParser()
+		if err := p.parse(test.src); err != nil {
+			t.Fatalf("%s: %v", test.src, err)
+		}
+		_, warnings, err := generate(p.hdr, config{pkg: "p"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], test.warning) {
+			t.Errorf("%s: expected warning containing %q, got %q", test.src, test.warning, warnings)
+		}
+	}
+	// a skipped struct doesn't leave an unused struc import
+	p := newParser()
+	if err := p.parse("struct ok { int x; };\nstruct bad { size_t n; short items[]; };"); err != nil {
+		t.Fatal(err)
+	}
+	out, warnings, err := generate(p.hdr, config{pkg: "p"})
+	if err != nil || len(warnings) != 1 {
+		t.Fatal(err, warnings)
+	}
+	if strings.Contains(string(out), "import") {
+		t.Errorf("output imports struc without using it:\n%s", out)
+	}
+}
+
+func TestCountAnnotations(t *testing.T) {
+	src := `
+struct a { int n; char data[] __attribute__((counted_by(n))); };
+typedef uint8_t mac_t[6];
+struct b { int n;
+	mac_t mac;
+	/* struc:sizefrom=n */
+	size_t data[]; };
+`
+	p := newParser()
+	if err := p.parse(src); err != nil {
+		t.Fatal(err)
+	}
+	out, warnings, err := generate(p.hdr, config{pkg: "p"})
+	if err != nil || len(warnings) != 0 {
+		t.Fatal(err, warnings)
+	}
+	for _, want := range []string{"Mac [6]uint8", "Data string `struc:\"sizefrom=N\"`", "Data []struc.Size_t `struc:\"[]size_t,sizefrom=N\"`"} {
+		if !strings.Contains(strings.Join(strings.Fields(string(out)), " "), want) {
+			t.Errorf("output is missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	for _, src := range []string{
+		"struct s { int a; ",
+		"/* unterminated",
+		"struct s { int a };",
+		"enum e { A = , B };",
+	} {
+		p := newParser()
+		if err := p.parse(src); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tEOF tokenKind = iota
+	tIdent
+	tNumber
+	tPunct
+	tDefine // the body of a #define line, name first
+	tAnnot  // a comment holding a struc: annotation
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func (t token) String() string {
+	if t.kind == tEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isIdent(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+// lex splits C source into tokens. Comments are dropped unless they hold a
+// struc: annotation, preprocessor lines other than #define are ignored, and
+// string and character literals are kept whole as punctuation.
+func lex(src string) ([]token, error) {
+	var toks []token
+	line := 1
+	bol := true // only whitespace since the start of the line
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			bol = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			i += 2
+			line++
+			continue
+		case c == '#' && bol:
+			start, startLine := i, line
+			for i < len(src) && (src[i] != '\n' || src[i-1] == '\\') {
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			text := strings.Replace(src[start+1:i], "\\\n", " ", -1)
+			text = stripComments(text)
+			fields := strings.Fields(text)
+			if len(fields) > 0 && fields[0] == "define" {
+				toks = append(toks, token{tDefine, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "define")), startLine})
+			}
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			toks = annotate(toks, src[i+2:i+end], line)
+			i += end
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			text := src[i+2 : i+2+end]
+			toks = annotate(toks, text, line)
+			line += strings.Count(text, "\n")
+			i += end + 4
+			continue
+		}
+		bol = false
+		start := i
+		switch {
+		case isIdent(c, true):
+			for i < len(src) && isIdent(src[i], false) {
+				i++
+			}
+			toks = append(toks, token{tIdent, src[start:i], line})
+		case c >= '0' && c <= '9':
+			for i < len(src) && (isIdent(src[i], false) || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tNumber, src[start:i], line})
+		case c == '"' || c == '\'':
+			for i++; i < len(src) && src[i] != c && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) || src[i] != c {
+				return nil, fmt.Errorf("line %d: unterminated literal", line)
+			}
+			i++
+			toks = append(toks, token{tPunct, src[start:i], line})
+		case strings.HasPrefix(src[i:], "<<") || strings.HasPrefix(src[i:], ">>"):
+			i += 2
+			toks = append(toks, token{tPunct, src[start:i], line})
+		default:
+			i++
+			toks = append(toks, token{tPunct, src[start:i], line})
+		}
+	}
+	return append(toks, token{tEOF, "", line}), nil
+}
+
+func annotate(toks []token, comment string, line int) []token {
+	if i := strings.Index(comment, "struc:"); i >= 0 {
+		text := strings.Fields(comment[i+len("struc:"):])
+		if len(text) > 0 {
+			toks = append(toks, token{tAnnot, text[0], line})
+		}
+	}
+	return toks
+}
+
+func stripComments(s string) string {
+	for {
+		if i := strings.Index(s, "/*"); i >= 0 {
+			end := strings.Index(s[i:], "*/")
+			if end < 0 {
+				return s[:i]
+			}
+			s = s[:i] + " " + s[i+end+2:]
+		} else if i := strings.Index(s, "//"); i >= 0 {
+			return s[:i]
+		} else {
+			return s
+		}
+	}
+}
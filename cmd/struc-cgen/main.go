@@ -0,0 +1,82 @@
+// Command struc-cgen converts C struct, enum and #define declarations from
+// headers into Go types with struc tags:
+//
+//	struc-cgen -package proto -output proto_struc.go proto.h
+//
+// Headers are read as-is, without running the preprocessor: #include and
+// conditional directives are ignored, and object-like #define macros with
+// integer values become Go constants.
+//
+// Fixed arrays become Go arrays, char arrays become strings packed as
+// [N]cstring, size_t and off_t become struc.Size_t and struc.Off_t, and enums
+// become named int32 types. Integer sizes assume an LP64 target, where long
+// is 64 bits. A flexible array member becomes a slice whose length comes
+// from an earlier field, which must be named with __counted_by(field),
+// __attribute__((counted_by(field))) or a /* struc:sizefrom=field */ comment.
+//
+// Fields are packed with no C alignment padding. -order sets the byte order
+// of every field; with -order little, bitfields are also allocated from the
+// least significant bit, as GCC does on little-endian targets.
+//
+// Structs using pointers, unions, multidimensional arrays or other
+// unsupported types are left out with a warning.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	pkgName = flag.String("package", "main", "package name of the generated code")
+	output  = flag.String("output", "", "output file name; default standard output")
+	order   = flag.String("order", "", "byte order of all fields: little or big; default struc's")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: struc-cgen [-package name] [-output file] [-order little|big] header.h...\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("struc-cgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 || (*order != "" && *order != "little" && *order != "big") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, warnings, err := convert(flag.Args(), config{pkg: *pkgName, order: *order})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range warnings {
+		log.Print(w)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+	} else if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// convert parses the headers at paths in order and generates Go source.
+func convert(paths []string, cfg config) ([]byte, []string, error) {
+	p := newParser()
+	for _, path := range paths {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := p.parse(string(src)); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		cfg.sources = append(cfg.sources, filepath.Base(path))
+	}
+	return generate(p.hdr, cfg)
+}
@@ -0,0 +1,847 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cType is a C type usable as a struct member.
+type cType struct {
+	goType    string // Go type for a member of this type
+	strucType string // struc tag type, for arrays and bitfields
+	size      int    // size in bytes, 0 if it depends on Options
+	char      bool   // plain char, whose arrays become strings
+	integer   bool
+	strct     *cStruct
+	enum      *cEnum
+}
+
+// cTypedef is a typedef name, possibly for an array type.
+type cTypedef struct {
+	typ  *cType
+	dims []int
+}
+
+type cField struct {
+	cName, goName string
+	typ           *cType
+	dims          []int // array lengths, -1 for a flexible array member
+	bits          int
+	countedBy     string // C name of the field holding a flexible array's length
+	line          int
+}
+
+type cStruct struct {
+	cName  string // "struct tag", or the typedef name for anonymous structs
+	goName string
+	parent *cStruct // for anonymous structs declaring a member of parent
+	member string   // C name of that member
+	fields []*cField
+	line   int
+	err    error // why the struct can't be converted
+}
+
+type cConst struct {
+	cName, goName string
+	value         int64
+}
+
+type cEnum struct {
+	cName  string
+	goName string // empty for anonymous enums, whose constants are untyped
+	consts []*cConst
+	line   int
+}
+
+// header holds the declarations found in C headers, in source order.
+type header struct {
+	defines []*cConst
+	decls   []interface{} // *cStruct or *cEnum
+}
+
+type parser struct {
+	toks   []token
+	pos    int
+	annots []string // struc: annotations seen since the last member
+
+	outer      *cStruct // struct whose members are being parsed
+	anonMember string   // member declared by an anonymous struct being parsed
+	specDims   []int    // array lengths of the typedef in the last typeSpec
+
+	hdr      *header
+	consts   map[string]int64
+	typedefs map[string]*cTypedef
+	structs  map[string]*cType
+	enums    map[string]*cType
+}
+
+func newParser() *parser {
+	p := &parser{
+		hdr:      &header{},
+		consts:   make(map[string]int64),
+		typedefs: make(map[string]*cTypedef),
+		structs:  make(map[string]*cType),
+		enums:    make(map[string]*cType),
+	}
+	for name, t := range builtinTypes {
+		p.typedefs[name] = &cTypedef{typ: t}
+	}
+	return p
+}
+
+func scalar(goType string, size int) *cType {
+	return &cType{goType: goType, strucType: goType, size: size, integer: goType != "float32" && goType != "float64" && goType != "bool"}
+}
+
+var builtinTypes = map[string]*cType{
+	"int8_t":    scalar("int8", 1),
+	"uint8_t":   scalar("uint8", 1),
+	"int16_t":   scalar("int16", 2),
+	"uint16_t":  scalar("uint16", 2),
+	"int32_t":   scalar("int32", 4),
+	"uint32_t":  scalar("uint32", 4),
+	"int64_t":   scalar("int64", 8),
+	"uint64_t":  scalar("uint64", 8),
+	"size_t":    {goType: "struc.Size_t", strucType: "size_t", integer: true},
+	"ssize_t":   {goType: "struc.Off_t", strucType: "off_t", integer: true},
+	"off_t":     {goType: "struc.Off_t", strucType: "off_t", integer: true},
+	"bool":      scalar("bool", 1),
+	"_Bool":     scalar("bool", 1),
+	"float32_t": scalar("float32", 4),
+	"float64_t": scalar("float64", 8),
+}
+
+// parse parses the C declarations in src, adding them to p.hdr.
+func (p *parser) parse(src string) error {
+	toks, err := lex(src)
+	if err != nil {
+		return err
+	}
+	p.toks, p.pos = toks, 0
+	for p.peek().kind != tEOF {
+		if err := p.topLevel(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peek returns the next token, handling any #define lines and annotations
+// before it.
+func (p *parser) peek() token {
+	for {
+		t := p.toks[p.pos]
+		switch t.kind {
+		case tDefine:
+			p.define(t)
+		case tAnnot:
+			p.annots = append(p.annots, t.text)
+		default:
+			return t
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return t.kind != tEOF && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); t.text != text || t.kind == tEOF {
+		return fmt.Errorf("line %d: expected %q, found %v", t.line, text, t)
+	}
+	return nil
+}
+
+func (p *parser) ident() (token, error) {
+	t := p.next()
+	if t.kind != tIdent {
+		return t, fmt.Errorf("line %d: expected a name, found %v", t.line, t)
+	}
+	return t, nil
+}
+
+// skip skips the rest of a declaration, up to a ';' or the end of a
+// top-level braced block such as a function body.
+func (p *parser) skip() {
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tEOF:
+			return
+		case t.text == "(" || t.text == "[" || t.text == "{":
+			depth++
+		case t.text == ")" || t.text == "]":
+			depth--
+		case t.text == "}":
+			if depth--; depth <= 0 {
+				p.accept(";")
+				return
+			}
+		case t.text == ";" && depth <= 0:
+			return
+		}
+	}
+}
+
+// define records an object-like macro whose body is an integer constant.
+func (p *parser) define(t token) {
+	end := strings.IndexFunc(t.text, func(r rune) bool { return !isIdent(byte(r), false) })
+	if end < 0 {
+		end = len(t.text)
+	}
+	name, body := t.text[:end], t.text[end:]
+	if name == "" || strings.HasPrefix(body, "(") || strings.TrimSpace(body) == "" {
+		return
+	}
+	toks, err := lex(body)
+	if err != nil {
+		return
+	}
+	sub := &parser{toks: toks, consts: p.consts, typedefs: p.typedefs}
+	v, err := sub.expr()
+	if err != nil || sub.peek().kind != tEOF {
+		return
+	}
+	p.consts[name] = v
+	p.hdr.defines = append(p.hdr.defines, &cConst{cName: name, goName: goName(name), value: v})
+}
+
+func (p *parser) topLevel() error {
+	switch {
+	case p.accept(";"), p.accept("}"):
+		return nil
+	case p.is("extern") && p.toks[p.pos+1].text == `"C"`:
+		// extern "C" { ... }, whose closing brace is skipped above
+		p.pos += 2
+		p.accept("{")
+		return nil
+	case p.accept("typedef"):
+		return p.typedef()
+	case p.is("struct") || p.is("enum"):
+		if _, err := p.typeSpec(); err != nil {
+			if _, ok := err.(*syntaxError); ok {
+				return err
+			}
+		}
+		if !p.accept(";") {
+			p.skip()
+		}
+		return nil
+	}
+	p.skip()
+	return nil
+}
+
+// A syntaxError stops parsing, unlike errors about unsupported types, which
+// only make the declaration using them unavailable.
+type syntaxError struct {
+	error
+}
+
+func (p *parser) typedef() error {
+	typ, err := p.typeSpec()
+	if err != nil {
+		if _, ok := err.(*syntaxError); ok {
+			return err
+		}
+		p.skip()
+		return nil
+	}
+	typeDims := p.specDims
+	for {
+		name, dims, err := p.declarator()
+		if err != nil {
+			p.skip()
+			return nil
+		}
+		if s := typ.strct; s != nil && s.goName == "" {
+			s.cName, s.goName = name.text, goTypeName(name.text)
+			p.addStruct(s)
+		}
+		if e := typ.enum; e != nil && e.goName == "" {
+			e.cName, e.goName = name.text, goTypeName(name.text)
+			typ.goType = e.goName
+		}
+		p.typedefs[name.text] = &cTypedef{typ: typ, dims: append(dims, typeDims...)}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return &syntaxError{err}
+	}
+	return nil
+}
+
+// declarator parses a typedef name and its array dimensions.
+func (p *parser) declarator() (token, []int, error) {
+	if t := p.peek(); t.text == "*" || t.text == "(" {
+		return t, nil, fmt.Errorf("line %d: pointers are not supported", t.line)
+	}
+	name, err := p.ident()
+	if err != nil {
+		return name, nil, err
+	}
+	var dims []int
+	for p.accept("[") {
+		n, err := p.expr()
+		if err != nil {
+			return name, nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return name, nil, err
+		}
+		dims = append(dims, int(n))
+	}
+	return name, dims, nil
+}
+
+var qualifiers = map[string]bool{
+	"const": true, "volatile": true, "restrict": true, "register": true,
+	"static": true, "extern": true, "inline": true,
+}
+
+var basicWords = map[string]bool{
+	"signed": true, "unsigned": true, "char": true, "short": true,
+	"int": true, "long": true, "float": true, "double": true, "void": true,
+}
+
+// typeSpec parses type specifiers, such as "unsigned long" or a struct
+// definition.
+func (p *parser) typeSpec() (*cType, error) {
+	p.specDims = nil
+	var words []string
+	var typ *cType
+	for {
+		t := p.peek()
+		switch {
+		case t.kind != tIdent:
+		case qualifiers[t.text]:
+			p.pos++
+			continue
+		case t.text == "__attribute__":
+			p.attribute()
+			continue
+		case basicWords[t.text] && typ == nil:
+			words = append(words, t.text)
+			p.pos++
+			continue
+		case len(words) > 0 || typ != nil:
+		case t.text == "struct":
+			p.pos++
+			s, err := p.structSpec()
+			if err != nil {
+				return nil, err
+			}
+			typ = s
+			continue
+		case t.text == "union":
+			return nil, fmt.Errorf("line %d: unions are not supported", t.line)
+		case t.text == "enum":
+			p.pos++
+			e, err := p.enumSpec()
+			if err != nil {
+				return nil, err
+			}
+			typ = e
+			continue
+		default:
+			td, ok := p.typedefs[t.text]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown type %s", t.line, t.text)
+			}
+			p.pos++
+			typ = td.typ
+			p.specDims = td.dims
+			continue
+		}
+		break
+	}
+	if typ != nil {
+		return typ, nil
+	}
+	if len(words) == 0 {
+		t := p.peek()
+		return nil, &syntaxError{fmt.Errorf("line %d: expected a type, found %v", t.line, t)}
+	}
+	return basicType(words, p.peek().line)
+}
+
+// basicType resolves C basic type keywords, assuming an LP64 target.
+func basicType(words []string, line int) (*cType, error) {
+	var signed, unsigned bool
+	var char, short, long, int_, float, double int
+	for _, w := range words {
+		switch w {
+		case "signed":
+			signed = true
+		case "unsigned":
+			unsigned = true
+		case "char":
+			char++
+		case "short":
+			short++
+		case "long":
+			long++
+		case "int":
+			int_++
+		case "float":
+			float++
+		case "double":
+			double++
+		case "void":
+			return nil, fmt.Errorf("line %d: void is not supported", line)
+		}
+	}
+	prefix := ""
+	if unsigned {
+		prefix = "u"
+	}
+	switch {
+	case signed && unsigned:
+	case float == 1 && len(words) == 1:
+		return scalar("float32", 4), nil
+	case double == 1 && len(words) == 1:
+		return scalar("float64", 8), nil
+	case float+double > 0:
+	case char == 1 && short+long+int_ == 0:
+		t := scalar(prefix+"int8", 1)
+		t.char = !signed && !unsigned
+		return t, nil
+	case short == 1 && long+char == 0 && int_ <= 1:
+		return scalar(prefix+"int16", 2), nil
+	case long > 0 && long <= 2 && short+char == 0 && int_ <= 1:
+		return scalar(prefix+"int64", 8), nil
+	case short+long+char == 0 && int_ <= 1:
+		return scalar(prefix+"int32", 4), nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported type %s", line, strings.Join(words, " "))
+}
+
+// attribute skips __attribute__((...)), returning the counted_by argument
+// if there is one.
+func (p *parser) attribute() string {
+	p.pos++
+	counted := ""
+	if !p.is("(") {
+		return ""
+	}
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tEOF:
+			return counted
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			if depth--; depth == 0 {
+				return counted
+			}
+		case t.text == "counted_by" || t.text == "__counted_by__":
+			if p.accept("(") {
+				depth++
+				if name := p.peek(); name.kind == tIdent {
+					counted = name.text
+				}
+			}
+		}
+	}
+}
+
+func (p *parser) structSpec() (*cType, error) {
+	line := p.peek().line
+	tag := ""
+	if t := p.peek(); t.kind == tIdent {
+		tag = t.text
+		p.pos++
+	}
+	if !p.is("{") {
+		if typ, ok := p.structs[tag]; ok && tag != "" {
+			return typ, nil
+		}
+		return nil, fmt.Errorf("line %d: unknown type struct %s", line, tag)
+	}
+	s := &cStruct{line: line}
+	typ := &cType{strct: s}
+	if tag != "" {
+		s.cName, s.goName = "struct "+tag, goTypeName(tag)
+		p.structs[tag] = typ
+		p.addStruct(s)
+	} else if p.outer != nil && p.anonMember != "" {
+		// named after the member it declares, once the outer struct is
+		s.parent, s.member = p.outer, p.anonMember
+		p.addStruct(s)
+	}
+	outer := p.outer
+	p.outer = s
+	defer func() { p.outer = outer }()
+	p.pos++
+	for !p.accept("}") {
+		if p.peek().kind == tEOF {
+			return nil, &syntaxError{fmt.Errorf("line %d: unterminated struct", line)}
+		}
+		if err := p.member(s); err != nil {
+			if _, ok := err.(*syntaxError); ok {
+				return nil, err
+			}
+			if s.err == nil {
+				s.err = err
+			}
+			p.skipMember()
+		}
+	}
+	if len(s.fields) == 0 && s.err == nil {
+		s.err = fmt.Errorf("line %d: empty structs are not supported", line)
+	}
+	return typ, nil
+}
+
+func (p *parser) addStruct(s *cStruct) {
+	p.hdr.decls = append(p.hdr.decls, s)
+}
+
+// skipMember skips the rest of a struct member after an error.
+func (p *parser) skipMember() {
+	depth := 0
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tEOF:
+			return
+		case t.text == "{" || t.text == "(" || t.text == "[":
+			depth++
+		case t.text == ")" || t.text == "]":
+			depth--
+		case t.text == "}":
+			if depth == 0 {
+				return
+			}
+			depth--
+		case t.text == ";" && depth <= 0:
+			p.pos++
+			p.annots = nil
+			return
+		}
+		p.pos++
+	}
+}
+
+// member parses a struct member declaration, which may declare several
+// fields.
+func (p *parser) member(s *cStruct) error {
+	annots := p.annots
+	line := p.peek().line
+	p.anonMember = ""
+	if p.is("struct") && p.toks[p.pos+1].text == "{" {
+		// find the name of the member an anonymous struct declares
+		depth := 0
+		for i := p.pos + 1; i < len(p.toks)-1; i++ {
+			if p.toks[i].text == "{" {
+				depth++
+			} else if p.toks[i].text == "}" {
+				if depth--; depth == 0 {
+					if name := p.toks[i+1]; name.kind == tIdent {
+						p.anonMember = name.text
+					}
+					break
+				}
+			}
+		}
+	}
+	typ, err := p.typeSpec()
+	p.anonMember = ""
+	if err != nil {
+		return err
+	}
+	typeDims := p.specDims
+	for {
+		f := &cField{typ: typ, line: line}
+		if t := p.peek(); t.text == "*" || t.text == "(" {
+			return fmt.Errorf("line %d: pointers are not supported", t.line)
+		}
+		name, err := p.ident()
+		if err != nil {
+			return &syntaxError{err}
+		}
+		f.cName, f.goName = name.text, goName(name.text)
+		for p.accept("[") {
+			if p.accept("]") {
+				f.dims = append(f.dims, -1)
+				continue
+			}
+			n, err := p.expr()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("]"); err != nil {
+				return &syntaxError{err}
+			}
+			if n == 0 {
+				// the old GNU spelling of a flexible array member
+				n = -1
+			} else if n < 0 {
+				return fmt.Errorf("line %d: negative array length", line)
+			}
+			f.dims = append(f.dims, int(n))
+		}
+		f.dims = append(f.dims, typeDims...)
+		if p.accept(":") {
+			n, err := p.expr()
+			if err != nil {
+				return err
+			}
+			f.bits = int(n)
+		}
+		for {
+			if p.is("__attribute__") {
+				if c := p.attribute(); c != "" {
+					f.countedBy = c
+				}
+			} else if p.accept("__counted_by") {
+				if err := p.expect("("); err != nil {
+					return &syntaxError{err}
+				}
+				c, err := p.ident()
+				if err != nil {
+					return &syntaxError{err}
+				}
+				f.countedBy = c.text
+				if err := p.expect(")"); err != nil {
+					return &syntaxError{err}
+				}
+			} else {
+				break
+			}
+		}
+		s.fields = append(s.fields, f)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(";"); err != nil {
+		return &syntaxError{err}
+	}
+	// annotations before the member or at the end of its line
+	if t := p.toks[p.pos]; t.kind == tAnnot && t.line == p.toks[p.pos-1].line {
+		annots = append(annots, t.text)
+		p.pos++
+	}
+	p.annots = nil
+	last := s.fields[len(s.fields)-1]
+	for _, a := range annots {
+		if strings.HasPrefix(a, "sizefrom=") {
+			last.countedBy = strings.TrimPrefix(a, "sizefrom=")
+		} else {
+			return fmt.Errorf("line %d: unknown annotation struc:%s", line, a)
+		}
+	}
+	return nil
+}
+
+func (p *parser) enumSpec() (*cType, error) {
+	line := p.peek().line
+	tag := ""
+	if t := p.peek(); t.kind == tIdent {
+		tag = t.text
+		p.pos++
+	}
+	if !p.is("{") {
+		if typ, ok := p.enums[tag]; ok && tag != "" {
+			return typ, nil
+		}
+		return nil, fmt.Errorf("line %d: unknown type enum %s", line, tag)
+	}
+	p.pos++
+	e := &cEnum{line: line}
+	typ := scalar("int32", 4)
+	typ.enum = e
+	if tag != "" {
+		e.cName, e.goName = "enum "+tag, goTypeName(tag)
+		typ.goType = e.goName
+		p.enums[tag] = typ
+	}
+	p.hdr.decls = append(p.hdr.decls, e)
+	var next int64
+	for !p.accept("}") {
+		name, err := p.ident()
+		if err != nil {
+			return nil, &syntaxError{err}
+		}
+		if p.accept("=") {
+			if next, err = p.expr(); err != nil {
+				return nil, &syntaxError{err}
+			}
+		}
+		p.consts[name.text] = next
+		e.consts = append(e.consts, &cConst{cName: name.text, goName: goName(name.text), value: next})
+		next++
+		if !p.accept(",") {
+			if err := p.expect("}"); err != nil {
+				return nil, &syntaxError{err}
+			}
+			break
+		}
+	}
+	return typ, nil
+}
+
+// expr evaluates an integer constant expression.
+func (p *parser) expr() (int64, error) {
+	return p.binary(0)
+}
+
+var precedence = map[string]int{
+	"|": 1, "^": 2, "&": 3, "<<": 4, ">>": 4, "+": 5, "-": 5, "*": 6, "/": 6, "%": 6,
+}
+
+func (p *parser) binary(min int) (int64, error) {
+	x, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tPunct || !ok || prec <= min {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.binary(prec)
+		if err != nil {
+			return 0, err
+		}
+		switch t.text {
+		case "|":
+			x |= y
+		case "^":
+			x ^= y
+		case "&":
+			x &= y
+		case "<<":
+			x <<= uint64(y)
+		case ">>":
+			x >>= uint64(y)
+		case "+":
+			x += y
+		case "-":
+			x -= y
+		case "*":
+			x *= y
+		case "/", "%":
+			if y == 0 {
+				return 0, fmt.Errorf("line %d: division by zero", t.line)
+			}
+			if t.text == "/" {
+				x /= y
+			} else {
+				x %= y
+			}
+		}
+	}
+}
+
+func (p *parser) unary() (int64, error) {
+	t := p.next()
+	switch {
+	case t.text == "-" || t.text == "+" || t.text == "~" || t.text == "!":
+		x, err := p.unary()
+		switch t.text {
+		case "-":
+			x = -x
+		case "~":
+			x = ^x
+		case "!":
+			if x == 0 {
+				x = 1
+			} else {
+				x = 0
+			}
+		}
+		return x, err
+	case t.text == "(":
+		if t := p.peek(); t.kind == tIdent && (basicWords[t.text] || p.typedefs[t.text] != nil) {
+			// skip a cast
+			for !p.accept(")") {
+				if p.next().kind == tEOF {
+					return 0, fmt.Errorf("line %d: unterminated cast", t.line)
+				}
+			}
+			return p.unary()
+		}
+		x, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		return x, p.expect(")")
+	case t.kind == tNumber:
+		s := strings.TrimRight(t.text, "uUlL")
+		x, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(s, 0, 64)
+			if uerr != nil {
+				return 0, fmt.Errorf("line %d: bad number %s", t.line, t.text)
+			}
+			x = int64(u)
+		}
+		return x, nil
+	case t.kind == tPunct && len(t.text) == 3 && t.text[0] == '\'':
+		return int64(t.text[1]), nil
+	case t.kind == tIdent:
+		if x, ok := p.consts[t.text]; ok {
+			return x, nil
+		}
+		return 0, fmt.Errorf("line %d: %s is not a known constant", t.line, t.text)
+	}
+	return 0, fmt.Errorf("line %d: expected a constant, found %v", t.line, t)
+}
+
+// goName converts a C identifier to an exported Go name: snake_case words
+// are capitalized and ALL_CAPS words lowercased first, so MAX_NAME_LEN
+// becomes MaxNameLen.
+func goName(name string) string {
+	var out strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if word == "" {
+			continue
+		}
+		if strings.ToUpper(word) == word {
+			word = strings.ToLower(word)
+		}
+		out.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	s := out.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "X" + s
+	}
+	return s
+}
+
+// goTypeName is goName without the conventional _t suffix.
+func goTypeName(name string) string {
+	if len(name) > 2 && strings.HasSuffix(name, "_t") {
+		name = name[:len(name)-2]
+	}
+	return goName(name)
+}
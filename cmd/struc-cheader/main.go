@@ -0,0 +1,183 @@
+// Command struc-cheader writes a C header declaring Go struct types with
+// their struc layout, using struc.WriteCHeader:
+//
+//	struc-cheader -type Header,Section -output proto.h ./proto
+//
+// It builds and runs a small program importing the package, so the package
+// must be importable from the current module. Nested struct types are
+// declared automatically. With -cabi, structs are naturally aligned for that
+// ABI instead of packed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default standard output")
+	guard     = flag.String("guard", "", "include guard macro; default derived from the output name")
+	ptrSize   = flag.Int("ptrsize", 0, "Options.PtrSize for Size_t and Off_t fields; default struc's")
+	order     = flag.String("order", "", "Options.Order: little or big; default the struct tags'")
+	cabi      = flag.String("cabi", "", "Options.CABI: amd64, 386, arm or arm64; default packed structs")
+)
+
+// abiNames maps -cabi values to struc.ABI constants.
+var abiNames = map[string]string{
+	"amd64": "ABIAmd64",
+	"386":   "ABI386",
+	"arm":   "ABIArm",
+	"arm64": "ABIArm64",
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: struc-cheader -type T[,T...] [-output file] [package]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("struc-cheader: ")
+	flag.Usage = usage
+	flag.Parse()
+	_, validABI := abiNames[*cabi]
+	if *typeNames == "" || flag.NArg() > 1 || (*order != "" && *order != "little" && *order != "big") || (*cabi != "" && !validABI) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	pkg := "."
+	if flag.NArg() == 1 {
+		pkg = flag.Arg(0)
+	}
+	body, err := run(pkg, strings.Split(*typeNames, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := *guard
+	if name == "" {
+		name = guardName(*output)
+	}
+	src := header(body, name)
+	if *output == "" {
+		os.Stdout.Write(src)
+	} else if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var nonIdent = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// guardName derives an include guard from the output file name.
+func guardName(output string) string {
+	base := filepath.Base(output)
+	if output == "" {
+		base = "struc.h"
+	}
+	return strings.ToUpper(nonIdent.ReplaceAllString(base, "_")) + "_"
+}
+
+func header(body []byte, guard string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "/* Code generated by struc-cheader; DO NOT EDIT. */\n\n")
+	fmt.Fprintf(&buf, "#ifndef %s\n#define %s\n\n", guard, guard)
+	buf.Write(body)
+	fmt.Fprintf(&buf, "\n#endif /* %s */\n", guard)
+	return buf.Bytes()
+}
+
+var program = template.Must(template.New("main").Parse(`package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/lunixbochs/struc"
+	pkg {{printf "%q" .Import}}
+)
+
+var _ = binary.BigEndian
+
+func main() {
+	options := &struc.Options{PtrSize: {{.PtrSize}}{{if .Order}}, Order: binary.{{.Order}}{{end}}{{if .CABI}}, CABI: struc.{{.CABI}}{{end}}}
+	err := struc.WriteCHeader(os.Stdout, options{{range .Types}}, (*pkg.{{.}})(nil){{end}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
+
+type programData struct {
+	Import  string
+	Types   []string
+	PtrSize int
+	Order   string
+	CABI    string
+}
+
+// run writes a program calling struc.WriteCHeader for the types in pkg into
+// a temporary directory next to pkg, so it builds within the same module,
+// and returns its output.
+func run(pkg string, types []string) ([]byte, error) {
+	list, err := exec.Command("go", "list", "-f", "{{.ImportPath}} {{.Name}} {{.Dir}}", pkg).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("go list %s: %s", pkg, ee.Stderr)
+		}
+		return nil, err
+	}
+	fields := strings.Fields(string(list))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("go list %s: unexpected output %q", pkg, list)
+	}
+	if fields[1] == "main" {
+		return nil, fmt.Errorf("%s is a main package, which can't be imported", pkg)
+	}
+	data := programData{Import: fields[0], Types: types, PtrSize: *ptrSize, CABI: abiNames[*cabi]}
+	switch *order {
+	case "little":
+		data.Order = "LittleEndian"
+	case "big":
+		data.Order = "BigEndian"
+	}
+	dir, err := ioutil.TempDir(fields[2], ".struc-cheader")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	var src bytes.Buffer
+	if err := program.Execute(&src, data); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), src.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// go run reports the program's exit status after its output
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndex(msg, "\nexit status "); i >= 0 {
+			msg = msg[:i]
+		}
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuardName(t *testing.T) {
+	tests := map[string]string{
+		"":                "STRUC_H_",
+		"proto.h":         "PROTO_H_",
+		"out/my-proto.h":  "MY_PROTO_H_",
+		"/abs/v1.2/x.hpp": "X_HPP_",
+	}
+	for output, want := range tests {
+		if got := guardName(output); got != want {
+			t.Errorf("guardName(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program")
+	}
+	*order = "little"
+	defer func() { *order = "" }()
+	out, err := run("../strucgen/example", []string{"Point"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "/* Point: fields are little-endian. */\nstruct Point {\n\tint16_t x;") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	*cabi = "amd64"
+	out, err = run("../strucgen/example", []string{"Point"})
+	*cabi = ""
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "#pragma pack") {
+		t.Fatalf("naturally aligned output is packed:\n%s", out)
+	}
+	_, err = run("../strucgen/example", []string{"Section"})
+	if err == nil || !strings.Contains(err.Error(), "flexible array member") {
+		t.Fatalf("expected a flexible array member error, got %v", err)
+	}
+	if _, err := run(".", []string{"T"}); err == nil || !strings.Contains(err.Error(), "main package") {
+		t.Fatalf("expected a main package error, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Command struc decodes and encodes binary data described by a struc schema
+// (see struc.ParseFormats), without writing Go:
+//
+//	struc decode -schema header.struc file.bin > file.json
+//	struc dump -schema header.struc file.bin
+//	struc encode -schema header.struc file.json > file.bin
+//
+// decode writes a JSON object, dump writes an annotated hexdump, and encode
+// reads a JSON object as written by decode. Byte arrays are JSON arrays of
+// numbers. The struct is the first one in the schema unless -type is set,
+// and input is read from standard input if no file is given.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lunixbochs/struc"
+)
+
+var (
+	schemaFile = flag.String("schema", "", "schema file name; must be set")
+	typeName   = flag.String("type", "", "struct to decode or encode; default the schema's first")
+	order      = flag.String("order", "", "Options.Order: little or big; default the schema's")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: struc decode|dump|encode -schema file [-type T] [input]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("struc: ")
+	flag.Usage = usage
+	if len(os.Args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	flag.CommandLine.Parse(os.Args[2:])
+	validCmd := cmd == "decode" || cmd == "dump" || cmd == "encode"
+	if !validCmd || *schemaFile == "" || flag.NArg() > 1 || (*order != "" && *order != "little" && *order != "big") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, err := ioutil.ReadFile(*schemaFile)
+	if err != nil {
+		fatal(err)
+	}
+	format, err := lookup(string(src), *typeName)
+	if err != nil {
+		fatal(err)
+	}
+	in := io.Reader(os.Stdin)
+	if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	options := &struc.Options{}
+	switch *order {
+	case "little":
+		options.Order = binary.LittleEndian
+	case "big":
+		options.Order = binary.BigEndian
+	}
+	out := bufio.NewWriter(os.Stdout)
+	switch cmd {
+	case "decode":
+		err = decode(out, in, format, options)
+	case "dump":
+		err = format.Dump(out, bufio.NewReader(in), options)
+	case "encode":
+		err = encode(out, in, format, options)
+	}
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// fatal exits with err. The log prefix names the command, so it is trimmed
+// from library errors, which start with it too.
+func fatal(err error) {
+	log.Fatal(strings.TrimPrefix(err.Error(), "struc: "))
+}
+
+// lookup parses a schema and returns the Format of struct name, or of the
+// first struct if name is empty.
+func lookup(src, name string) (*struc.Format, error) {
+	formats, names, err := struc.ParseFormats(src)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = names[0]
+	}
+	format, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("schema has no struct %s", name)
+	}
+	return format, nil
+}
+
+func decode(w io.Writer, r io.Reader, format *struc.Format, options *struc.Options) error {
+	rec, err := format.Unpack(bufio.NewReader(r), options)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(jsonValue(reflect.ValueOf(rec)), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+func encode(w io.Writer, r io.Reader, format *struc.Format, options *struc.Options) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var rec map[string]interface{}
+	if err := dec.Decode(&rec); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := format.Pack(&buf, recordValue(rec).(map[string]interface{}), options); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// jsonValue converts byte slices in a decoded Record to slices of numbers,
+// which encoding/json would otherwise write as base64.
+func jsonValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[k.String()] = jsonValue(v.MapIndex(k))
+		}
+		return m
+	case reflect.Slice:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = jsonValue(v.Index(i))
+		}
+		return s
+	}
+	return v.Interface()
+}
+
+// recordValue converts the json.Numbers of a decoded JSON value to int64,
+// uint64 or float64, whichever holds them exactly.
+func recordValue(x interface{}) interface{} {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			x[k] = recordValue(v)
+		}
+	case []interface{}:
+		for i, v := range x {
+			x[i] = recordValue(v)
+		}
+	case json.Number:
+		if n, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	}
+	return x
+}
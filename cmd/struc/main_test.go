@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const schema = `
+struct Packet {
+	magic uint16 = 0xBEEF;
+	count uint8;
+	data  [count]byte;
+	name  [4]string;
+	pts   [2]Point;
+}
+struct Point { x int16 little; y float32; }
+`
+
+func TestRoundTrip(t *testing.T) {
+	format, err := lookup(schema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []byte{
+		0xbe, 0xef, 3, 1, 2, 3, 'a', 'b', 'c', 'd',
+		1, 0, 0x3f, 0x80, 0, 0,
+		0xff, 0xff, 0xc0, 0, 0, 0,
+	}
+	var js bytes.Buffer
+	if err := decode(&js, bytes.NewReader(in), format, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"data": [`, `"name": "abcd"`, `"magic": 48879`, `"x": -1`, `"y": -2`} {
+		if !strings.Contains(js.String(), want) {
+			t.Errorf("JSON is missing %s:\n%s", want, js.String())
+		}
+	}
+	var out bytes.Buffer
+	if err := encode(&out, &js, format, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), in) {
+		t.Fatalf("encoded % x, want % x", out.Bytes(), in)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if _, err := lookup(schema, "Point"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lookup(schema, "Missing"); err == nil || !strings.Contains(err.Error(), "no struct Missing") {
+		t.Fatalf("expected a missing struct error, got %v", err)
+	}
+}
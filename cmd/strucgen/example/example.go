@@ -0,0 +1,41 @@
+// Package example holds structs with generated struc methods, used to test
+// cmd/strucgen against the reflective encoder.
+package example
+
+//go:generate go run .. -type Header,Section,Point
+
+type Kind uint8
+
+type Header struct {
+	Magic    [4]byte
+	Version  uint16 `struc:"little"`
+	Flags    Kind
+	Big      bool `struc:"uint16"`
+	Count    int  `struc:"uint8,sizeof=Sections"`
+	Sections []Section
+	NameLen  int `struc:"int16,sizeof=Name"`
+	Name     string
+	Comment  string `struc:"cstring"`
+	Label    []byte `struc:"[8]cstring"`
+	Points   [2]Point
+	Weights  []float32 `struc:"[3]float32,little"`
+	Pad      []byte    `struc:"[3]pad"`
+	Wide     []int     `struc:"[2]int64"`
+	Short    string    `struc:"[4]byte"`
+	Ratio    float64
+	private  int
+	Skipped  int `struc:"skip"`
+}
+
+type Section struct {
+	ID     int32
+	Signed int8
+	Len    uint32 `struc:"sizeof=Data"`
+	Data   []byte
+	Vals   []int16 `struc:"[]int16,little,sizefrom=Len"`
+	On     []bool  `struc:"[2]bool"`
+}
+
+type Point struct {
+	X, Y int16
+}
@@ -0,0 +1,131 @@
+package example
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/lunixbochs/struc"
+)
+
+// reflectHeader has Header's fields and tags but no generated methods, so
+// struc packs it with reflection.
+type reflectHeader Header
+
+func samples() []Header {
+	return []Header{
+		{},
+		{
+			Magic:   [4]byte{'S', 'T', 'R', 'C'},
+			Version: 3,
+			Flags:   7,
+			Big:     true,
+			Sections: []Section{
+				{ID: -1, Signed: -5, Data: []byte{1, 2, 3}, Vals: []int16{-1, 2, 300}, On: []bool{true, false}},
+				{ID: 2, Data: []byte{}, Vals: []int16{}, On: []bool{false, true}},
+			},
+			Name:    "a name",
+			Comment: "a comment",
+			Label:   []byte("label"),
+			Points:  [2]Point{{1, -2}, {-3, 4}},
+			Weights: []float32{0.5, -1.25, 3},
+			Wide:    []int{-1 << 40, 1 << 40},
+			Short:   "abcd",
+			Ratio:   -3.75,
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	opts := []*struc.Options{nil, {Order: binary.LittleEndian}}
+	for i, h := range samples() {
+		for _, opt := range opts {
+			var want bytes.Buffer
+			if err := struc.PackWithOptions(&want, (*reflectHeader)(&h), opt); err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := struc.PackWithOptions(&got, &h, opt); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("sample %d: generated %v\nreflective %v", i, got.Bytes(), want.Bytes())
+			}
+			size, err := h.StrucSize(opt)
+			if err != nil || size != want.Len() {
+				t.Fatalf("sample %d: StrucSize %d, %v; want %d", i, size, err, want.Len())
+			}
+
+			var fromGen Header
+			if err := struc.UnpackWithOptions(bytes.NewReader(want.Bytes()), &fromGen, opt); err != nil {
+				t.Fatal(err)
+			}
+			var fromReflect reflectHeader
+			if err := struc.UnpackWithOptions(bytes.NewReader(want.Bytes()), &fromReflect, opt); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fromGen, Header(fromReflect)) {
+				t.Fatalf("sample %d: generated %+v\nreflective %+v", i, fromGen, fromReflect)
+			}
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	h := samples()[1]
+	packed, err := struc.AppendPack(nil, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := struc.Unpack(bytes.NewReader(nil), &Header{}); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	for _, n := range []int{1, 4, 12, len(packed) - 1} {
+		err := struc.Unpack(bytes.NewReader(packed[:n]), &Header{})
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated to %d: expected io.ErrUnexpectedEOF, got %v", n, err)
+		}
+	}
+	err = struc.UnpackWithOptions(bytes.NewReader(packed), &Header{}, &struc.Options{MaxSliceLen: 1})
+	var le *struc.LimitError
+	if !errors.As(err, &le) || le.Limit != "MaxSliceLen" {
+		t.Fatalf("expected MaxSliceLen error, got %v", err)
+	}
+}
+
+func BenchmarkGeneratedPack(b *testing.B) {
+	h := samples()[1]
+	buf := make([]byte, 0, 256)
+	for i := 0; i < b.N; i++ {
+		buf, _ = struc.AppendPack(buf[:0], &h)
+	}
+}
+
+func BenchmarkReflectPack(b *testing.B) {
+	h := samples()[1]
+	buf := make([]byte, 0, 256)
+	for i := 0; i < b.N; i++ {
+		buf, _ = struc.AppendPack(buf[:0], (*reflectHeader)(&h))
+	}
+}
+
+func BenchmarkGeneratedUnpack(b *testing.B) {
+	h := samples()[1]
+	packed, _ := struc.AppendPack(nil, &h)
+	var out Header
+	for i := 0; i < b.N; i++ {
+		struc.UnpackBytes(packed, &out)
+	}
+}
+
+func BenchmarkReflectUnpack(b *testing.B) {
+	h := samples()[1]
+	packed, _ := struc.AppendPack(nil, &h)
+	var out reflectHeader
+	for i := 0; i < b.N; i++ {
+		struc.UnpackBytes(packed, &out)
+	}
+}
@@ -0,0 +1,730 @@
+// Code generated by "strucgen -type Header,Section,Point"; DO NOT EDIT.
+
+package example
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/lunixbochs/struc"
+)
+
+// StrucSize returns the packed size of s.
+func (s *Header) StrucSize(opt *struc.Options) (int, error) {
+	size := 0
+	size += 4 // Magic
+	size += 2 // Version
+	size += 1 // Flags
+	size += 2 // Big
+	size += 1 // Count
+	for i := range s.Sections {
+		n, err := s.Sections[i].StrucSize(opt)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	size += 2 // NameLen
+	size += len(s.Name)
+	size += len(s.Comment) + 1
+	size += 8 // Label
+	for i := range s.Points {
+		n, err := s.Points[i].StrucSize(opt)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	size += 12 // Weights
+	size += 3  // Pad
+	size += 16 // Wide
+	size += 4  // Short
+	size += 8  // Ratio
+	return size, nil
+}
+
+// StrucPack packs s into buf, returning the number of bytes written.
+func (s *Header) StrucPack(buf []byte, opt *struc.Options) (int, error) {
+	var big binary.ByteOrder = binary.BigEndian
+	var little binary.ByteOrder = binary.LittleEndian
+	if opt != nil && opt.Order != nil {
+		big, little = opt.Order, opt.Order
+	}
+	pos := 0
+	// Magic
+	{
+		n := 4
+		var zero byte
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Magic) {
+				e = &s.Magic[i]
+			}
+			if len(buf)-pos < 1 {
+				return pos, io.ErrShortBuffer
+			}
+			buf[pos] = *e
+			pos += 1
+		}
+	}
+	// Version
+	{
+		if len(buf)-pos < 2 {
+			return pos, io.ErrShortBuffer
+		}
+		little.PutUint16(buf[pos:], s.Version)
+		pos += 2
+	}
+	// Flags
+	{
+		if len(buf)-pos < 1 {
+			return pos, io.ErrShortBuffer
+		}
+		buf[pos] = byte(s.Flags)
+		pos += 1
+	}
+	// Big
+	{
+		if len(buf)-pos < 2 {
+			return pos, io.ErrShortBuffer
+		}
+		var x uint8
+		if s.Big {
+			x = 1
+		}
+		big.PutUint16(buf[pos:], uint16(x))
+		pos += 2
+	}
+	// Count
+	{
+		if len(buf)-pos < 1 {
+			return pos, io.ErrShortBuffer
+		}
+		buf[pos] = byte(len(s.Sections))
+		pos += 1
+	}
+	// Sections
+	{
+		n := int(s.Count)
+		if n < 0 || int64(n) != int64(s.Count) {
+			return pos, fmt.Errorf("sizeof field `Count` holds invalid length %v", s.Count)
+		}
+		if n == 0 {
+			n = len(s.Sections)
+		}
+		var zero Section
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Sections) {
+				e = &s.Sections[i]
+			}
+			m, err := e.StrucPack(buf[pos:], opt)
+			if err != nil {
+				return pos, err
+			}
+			pos += m
+		}
+	}
+	// NameLen
+	{
+		if len(buf)-pos < 2 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint16(buf[pos:], uint16(len(s.Name)))
+		pos += 2
+	}
+	// Name
+	{
+		if len(buf)-pos < len(s.Name) {
+			return pos, io.ErrShortBuffer
+		}
+		pos += copy(buf[pos:], s.Name)
+	}
+	// Comment
+	{
+		if strings.IndexByte(s.Comment, 0) >= 0 {
+			return pos, fmt.Errorf("cstring field `Comment` contains a NUL byte")
+		}
+		size := len(s.Comment) + 1
+		if len(buf)-pos < size {
+			return pos, io.ErrShortBuffer
+		}
+		copy(buf[pos:], s.Comment)
+		for i := len(s.Comment); i < size; i++ {
+			buf[pos+i] = 0
+		}
+		pos += size
+	}
+	// Label
+	{
+		if bytes.IndexByte(s.Label, 0) >= 0 {
+			return pos, fmt.Errorf("cstring field `Label` contains a NUL byte")
+		}
+		size := len(s.Label) + 1
+		if size > 8 {
+			return pos, fmt.Errorf("cstring field `Label` is too long: %d bytes + NUL > 8", len(s.Label))
+		}
+		size = 8
+		if len(buf)-pos < size {
+			return pos, io.ErrShortBuffer
+		}
+		copy(buf[pos:], s.Label)
+		for i := len(s.Label); i < size; i++ {
+			buf[pos+i] = 0
+		}
+		pos += size
+	}
+	// Points
+	{
+		n := 2
+		var zero Point
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Points) {
+				e = &s.Points[i]
+			}
+			m, err := e.StrucPack(buf[pos:], opt)
+			if err != nil {
+				return pos, err
+			}
+			pos += m
+		}
+	}
+	// Weights
+	{
+		n := 3
+		var zero float32
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Weights) {
+				e = &s.Weights[i]
+			}
+			if len(buf)-pos < 4 {
+				return pos, io.ErrShortBuffer
+			}
+			little.PutUint32(buf[pos:], math.Float32bits(*e))
+			pos += 4
+		}
+	}
+	// Pad
+	{
+		n := 3
+		if len(buf)-pos < n {
+			return pos, io.ErrShortBuffer
+		}
+		for i := 0; i < n; i++ {
+			buf[pos+i] = 0
+		}
+		pos += n
+	}
+	// Wide
+	{
+		n := 2
+		var zero int
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Wide) {
+				e = &s.Wide[i]
+			}
+			if len(buf)-pos < 8 {
+				return pos, io.ErrShortBuffer
+			}
+			big.PutUint64(buf[pos:], uint64(*e))
+			pos += 8
+		}
+	}
+	// Short
+	{
+		n := 4
+		if len(buf)-pos < len(s.Short) || len(buf)-pos < n {
+			return pos, io.ErrShortBuffer
+		}
+		copy(buf[pos:], s.Short)
+		if len(s.Short) < n {
+			for i := len(s.Short); i < n; i++ {
+				buf[pos+i] = 0
+			}
+			pos += n
+		} else {
+			pos += len(s.Short)
+		}
+	}
+	// Ratio
+	{
+		if len(buf)-pos < 8 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint64(buf[pos:], math.Float64bits(s.Ratio))
+		pos += 8
+	}
+	return pos, nil
+}
+
+// StrucUnpack unpacks s from r.
+func (s *Header) StrucUnpack(r io.Reader, opt *struc.Options) error {
+	var tmp [8]byte
+	var big binary.ByteOrder = binary.BigEndian
+	var little binary.ByteOrder = binary.LittleEndian
+	if opt != nil && opt.Order != nil {
+		big, little = opt.Order, opt.Order
+	}
+	// Magic
+	{
+		n := 4
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			s.Magic[i] = b[i]
+		}
+	}
+	// Version
+	{
+		b, err := struc.ReadN(r, 2, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Version = little.Uint16(b)
+	}
+	// Flags
+	{
+		b, err := struc.ReadN(r, 1, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Flags = Kind(b[0])
+	}
+	// Big
+	{
+		b, err := struc.ReadN(r, 2, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Big = big.Uint16(b) != 0
+	}
+	// Count
+	{
+		b, err := struc.ReadN(r, 1, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Count = int(b[0])
+	}
+	// Sections
+	{
+		n := int(s.Count)
+		if n < 0 || int64(n) != int64(s.Count) {
+			return fmt.Errorf("sizeof field `Count` holds invalid length %v", s.Count)
+		}
+		if opt != nil && opt.MaxSliceLen > 0 && n > opt.MaxSliceLen {
+			return &struc.LimitError{Limit: "MaxSliceLen", Max: opt.MaxSliceLen, Value: int64(n)}
+		}
+		if cap(s.Sections) >= n {
+			s.Sections = s.Sections[:0]
+		} else if n > 1024 {
+			s.Sections = make([]Section, 0, 1024)
+		} else {
+			s.Sections = make([]Section, 0, n)
+		}
+		for i := 0; i < n; i++ {
+			s.Sections = append(s.Sections, Section{})
+			if err := s.Sections[i].StrucUnpack(r, opt); err != nil {
+				return err
+			}
+		}
+	}
+	// NameLen
+	{
+		b, err := struc.ReadN(r, 2, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.NameLen = int(int16(big.Uint16(b)))
+	}
+	// Name
+	{
+		n := int(s.NameLen)
+		if n < 0 || int64(n) != int64(s.NameLen) {
+			return fmt.Errorf("sizeof field `NameLen` holds invalid length %v", s.NameLen)
+		}
+		if opt != nil && opt.MaxSliceLen > 0 && n > opt.MaxSliceLen {
+			return &struc.LimitError{Limit: "MaxSliceLen", Max: opt.MaxSliceLen, Value: int64(n)}
+		}
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Name = string(b)
+	}
+	// Comment
+	{
+		var data []byte
+		for {
+			if opt != nil && opt.MaxSliceLen > 0 && len(data) >= opt.MaxSliceLen {
+				return &struc.LimitError{Limit: "MaxSliceLen", Max: opt.MaxSliceLen, Value: int64(len(data) + 1)}
+			}
+			b, err := struc.ReadN(r, 1, tmp[:])
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return err
+			}
+			if b[0] == 0 {
+				break
+			}
+			data = append(data, b[0])
+		}
+		s.Comment = string(data)
+	}
+	// Label
+	{
+		n := 8
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		s.Label = append([]byte{}, b...)
+	}
+	// Points
+	{
+		n := 2
+		for i := 0; i < n; i++ {
+			if err := s.Points[i].StrucUnpack(r, opt); err != nil {
+				return err
+			}
+		}
+	}
+	// Weights
+	{
+		n := 3
+		b, err := struc.ReadN(r, n*4, tmp[:])
+		if err != nil {
+			return err
+		}
+		if cap(s.Weights) < n {
+			s.Weights = make([]float32, n)
+		} else if len(s.Weights) < n {
+			s.Weights = s.Weights[:n]
+		}
+		for i := 0; i < n; i++ {
+			s.Weights[i] = math.Float32frombits(little.Uint32(b[i*4:]))
+		}
+	}
+	// Pad
+	{
+		n := 3
+		if _, err := struc.ReadN(r, n, tmp[:]); err != nil {
+			return err
+		}
+	}
+	// Wide
+	{
+		n := 2
+		b, err := struc.ReadN(r, n*8, tmp[:])
+		if err != nil {
+			return err
+		}
+		if cap(s.Wide) < n {
+			s.Wide = make([]int, n)
+		} else if len(s.Wide) < n {
+			s.Wide = s.Wide[:n]
+		}
+		for i := 0; i < n; i++ {
+			s.Wide[i] = int(int64(big.Uint64(b[i*8:])))
+		}
+	}
+	// Short
+	{
+		n := 4
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Short = string(b)
+	}
+	// Ratio
+	{
+		b, err := struc.ReadN(r, 8, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Ratio = math.Float64frombits(big.Uint64(b))
+	}
+	return nil
+}
+
+// StrucSize returns the packed size of s.
+func (s *Section) StrucSize(opt *struc.Options) (int, error) {
+	size := 0
+	size += 4 // ID
+	size += 1 // Signed
+	size += 4 // Len
+	size += len(s.Data)
+	size += len(s.Vals) * 2
+	size += 2 // On
+	return size, nil
+}
+
+// StrucPack packs s into buf, returning the number of bytes written.
+func (s *Section) StrucPack(buf []byte, opt *struc.Options) (int, error) {
+	var big binary.ByteOrder = binary.BigEndian
+	var little binary.ByteOrder = binary.LittleEndian
+	if opt != nil && opt.Order != nil {
+		big, little = opt.Order, opt.Order
+	}
+	pos := 0
+	// ID
+	{
+		if len(buf)-pos < 4 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint32(buf[pos:], uint32(s.ID))
+		pos += 4
+	}
+	// Signed
+	{
+		if len(buf)-pos < 1 {
+			return pos, io.ErrShortBuffer
+		}
+		buf[pos] = byte(s.Signed)
+		pos += 1
+	}
+	// Len
+	{
+		if len(buf)-pos < 4 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint32(buf[pos:], uint32(len(s.Data)))
+		pos += 4
+	}
+	// Data
+	{
+		n := int(s.Len)
+		if n < 0 || uint64(n) != uint64(s.Len) {
+			return pos, fmt.Errorf("sizeof field `Len` holds invalid length %v", s.Len)
+		}
+		if n == 0 {
+			n = len(s.Data)
+		}
+		if len(buf)-pos < len(s.Data) || len(buf)-pos < n {
+			return pos, io.ErrShortBuffer
+		}
+		copy(buf[pos:], s.Data)
+		if len(s.Data) < n {
+			for i := len(s.Data); i < n; i++ {
+				buf[pos+i] = 0
+			}
+			pos += n
+		} else {
+			pos += len(s.Data)
+		}
+	}
+	// Vals
+	{
+		n := int(s.Len)
+		if n < 0 || uint64(n) != uint64(s.Len) {
+			return pos, fmt.Errorf("sizeof field `Len` holds invalid length %v", s.Len)
+		}
+		if n == 0 {
+			n = len(s.Vals)
+		}
+		var zero int16
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.Vals) {
+				e = &s.Vals[i]
+			}
+			if len(buf)-pos < 2 {
+				return pos, io.ErrShortBuffer
+			}
+			little.PutUint16(buf[pos:], uint16(*e))
+			pos += 2
+		}
+	}
+	// On
+	{
+		n := 2
+		var zero bool
+		for i := 0; i < n; i++ {
+			e := &zero
+			if i < len(s.On) {
+				e = &s.On[i]
+			}
+			if len(buf)-pos < 1 {
+				return pos, io.ErrShortBuffer
+			}
+			if *e {
+				buf[pos] = 1
+			} else {
+				buf[pos] = 0
+			}
+			pos += 1
+		}
+	}
+	return pos, nil
+}
+
+// StrucUnpack unpacks s from r.
+func (s *Section) StrucUnpack(r io.Reader, opt *struc.Options) error {
+	var tmp [8]byte
+	var big binary.ByteOrder = binary.BigEndian
+	var little binary.ByteOrder = binary.LittleEndian
+	if opt != nil && opt.Order != nil {
+		big, little = opt.Order, opt.Order
+	}
+	// ID
+	{
+		b, err := struc.ReadN(r, 4, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.ID = int32(big.Uint32(b))
+	}
+	// Signed
+	{
+		b, err := struc.ReadN(r, 1, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Signed = int8(b[0])
+	}
+	// Len
+	{
+		b, err := struc.ReadN(r, 4, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Len = big.Uint32(b)
+	}
+	// Data
+	{
+		n := int(s.Len)
+		if n < 0 || uint64(n) != uint64(s.Len) {
+			return fmt.Errorf("sizeof field `Len` holds invalid length %v", s.Len)
+		}
+		if opt != nil && opt.MaxSliceLen > 0 && n > opt.MaxSliceLen {
+			return &struc.LimitError{Limit: "MaxSliceLen", Max: opt.MaxSliceLen, Value: int64(n)}
+		}
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		if cap(s.Data) < n {
+			s.Data = make([]byte, n)
+		} else if len(s.Data) < n {
+			s.Data = s.Data[:n]
+		}
+		copy(s.Data, b[:n])
+	}
+	// Vals
+	{
+		n := int(s.Len)
+		if n < 0 || uint64(n) != uint64(s.Len) {
+			return fmt.Errorf("sizeof field `Len` holds invalid length %v", s.Len)
+		}
+		if opt != nil && opt.MaxSliceLen > 0 && n > opt.MaxSliceLen {
+			return &struc.LimitError{Limit: "MaxSliceLen", Max: opt.MaxSliceLen, Value: int64(n)}
+		}
+		if n > int(^uint(0)>>1)/2 {
+			return fmt.Errorf("length %d is too large", n)
+		}
+		b, err := struc.ReadN(r, n*2, tmp[:])
+		if err != nil {
+			return err
+		}
+		if cap(s.Vals) < n {
+			s.Vals = make([]int16, n)
+		} else if len(s.Vals) < n {
+			s.Vals = s.Vals[:n]
+		}
+		for i := 0; i < n; i++ {
+			s.Vals[i] = int16(little.Uint16(b[i*2:]))
+		}
+	}
+	// On
+	{
+		n := 2
+		b, err := struc.ReadN(r, n, tmp[:])
+		if err != nil {
+			return err
+		}
+		if cap(s.On) < n {
+			s.On = make([]bool, n)
+		} else if len(s.On) < n {
+			s.On = s.On[:n]
+		}
+		for i := 0; i < n; i++ {
+			s.On[i] = b[i] != 0
+		}
+	}
+	return nil
+}
+
+// StrucSize returns the packed size of s.
+func (s *Point) StrucSize(opt *struc.Options) (int, error) {
+	size := 0
+	size += 2 // X
+	size += 2 // Y
+	return size, nil
+}
+
+// StrucPack packs s into buf, returning the number of bytes written.
+func (s *Point) StrucPack(buf []byte, opt *struc.Options) (int, error) {
+	var big binary.ByteOrder = binary.BigEndian
+	if opt != nil && opt.Order != nil {
+		big = opt.Order
+	}
+	pos := 0
+	// X
+	{
+		if len(buf)-pos < 2 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint16(buf[pos:], uint16(s.X))
+		pos += 2
+	}
+	// Y
+	{
+		if len(buf)-pos < 2 {
+			return pos, io.ErrShortBuffer
+		}
+		big.PutUint16(buf[pos:], uint16(s.Y))
+		pos += 2
+	}
+	return pos, nil
+}
+
+// StrucUnpack unpacks s from r.
+func (s *Point) StrucUnpack(r io.Reader, opt *struc.Options) error {
+	var tmp [8]byte
+	var big binary.ByteOrder = binary.BigEndian
+	if opt != nil && opt.Order != nil {
+		big = opt.Order
+	}
+	// X
+	{
+		b, err := struc.ReadN(r, 2, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.X = int16(big.Uint16(b))
+	}
+	// Y
+	{
+		b, err := struc.ReadN(r, 2, tmp[:])
+		if err != nil {
+			return err
+		}
+		s.Y = int16(big.Uint16(b))
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// field mirrors struc.Field for the subset of tags strucgen supports.
+type field struct {
+	Name     string
+	Type     string // struc type: "bool", "int8", ..., "float64", "pad", "cstring", "string" or "struct"
+	Elem     string // Go element type as written, e.g. "uint16" or "Section"
+	Kind     string // underlying kind of Elem, e.g. "int" or "struct"
+	DefType  string // struc type Kind packs as by default
+	Array    bool
+	Slice    bool
+	Len      int
+	Order    string // "big" or "little"
+	Sizeof   string // the field whose length this field holds
+	Sizefrom string // the field holding this field's length
+}
+
+// typeSizes lists the struc types strucgen supports and their sizes.
+var typeSizes = map[string]int{
+	"pad":     1,
+	"bool":    1,
+	"int8":    1,
+	"uint8":   1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"int64":   8,
+	"uint64":  8,
+	"float32": 4,
+	"float64": 8,
+	"cstring": 1,
+	"string":  1,
+}
+
+var typeAliases = map[string]string{
+	"byte": "uint8",
+}
+
+// unsupportedTypes are struc types strucgen leaves to reflection.
+var unsupportedTypes = map[string]bool{
+	"uvarint": true,
+	"varint":  true,
+	"leb128":  true,
+	"uleb128": true,
+	"sleb128": true,
+	"size_t":  true,
+	"off_t":   true,
+}
+
+// defTypes maps Go kinds to the struc type they pack as without a tag.
+var defTypes = map[string]string{
+	"bool":    "bool",
+	"int8":    "int8",
+	"int16":   "int16",
+	"int":     "int32",
+	"int32":   "int32",
+	"int64":   "int64",
+	"uint8":   "uint8",
+	"uint16":  "uint16",
+	"uint":    "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"float32": "float32",
+	"float64": "float64",
+	"string":  "string",
+	"struct":  "struct",
+}
+
+var builtinKinds = map[string]string{
+	"byte": "uint8",
+	"rune": "int32",
+}
+
+func intKind(kind string) bool {
+	return strings.HasPrefix(kind, "int") || strings.HasPrefix(kind, "uint")
+}
+
+type strucTag struct {
+	Type     string
+	Order    string
+	Sizeof   string
+	Sizefrom string
+	Skip     bool
+}
+
+// parseStrucTag follows struc's parseStrucTag.
+func parseStrucTag(tag reflect.StructTag) (*strucTag, error) {
+	t := &strucTag{Order: "big"}
+	tagStr := tag.Get("struc")
+	if tagStr == "" {
+		tagStr = tag.Get("struct")
+	}
+	for _, s := range strings.Split(tagStr, ",") {
+		switch {
+		case strings.HasPrefix(s, "sizeof="):
+			t.Sizeof = s[len("sizeof="):]
+		case strings.HasPrefix(s, "sizefrom="):
+			t.Sizefrom = s[len("sizefrom="):]
+		case s == "big" || s == "little":
+			t.Order = s
+		case s == "skip":
+			t.Skip = true
+		case s == "msb" || s == "lsb":
+		case strings.HasPrefix(s, "bits=") || strings.Contains(s, ":"):
+			return nil, fmt.Errorf("bitfields are not supported")
+		case strings.HasPrefix(s, "if="):
+			return nil, fmt.Errorf("if= is not supported")
+		case strings.HasPrefix(s, "switch="):
+			return nil, fmt.Errorf("switch= is not supported")
+		case strings.HasPrefix(s, "align=") || strings.HasPrefix(s, "offset="):
+			return nil, fmt.Errorf("align= and offset= are not supported")
+		case strings.HasPrefix(s, "const=") || strings.HasPrefix(s, "magic="):
+			return nil, fmt.Errorf("const= and magic= are not supported")
+		case strings.HasPrefix(s, "checksum=") || strings.HasPrefix(s, "range="):
+			return nil, fmt.Errorf("checksum= is not supported")
+		case strings.HasPrefix(s, "bytesizeof=") || strings.HasPrefix(s, "bytesizefrom="):
+			return nil, fmt.Errorf("bytesizeof= and bytesizefrom= are not supported")
+		default:
+			t.Type = s
+		}
+	}
+	return t, nil
+}
+
+var typeLenRe = regexp.MustCompile(`^\[(\d*)\]`)
+
+// structFields returns the packed fields of struct type name, following
+// struc's parseField and parseStructField.
+func (pkg *pkgInfo) structFields(name string, generated map[string]bool) ([]*field, error) {
+	st, ok := pkg.types[name].(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a struct type", name)
+	}
+	var fields []*field
+	byName := make(map[string]*field)
+	sizeofMap := make(map[string]string)
+	for _, af := range st.Fields.List {
+		if len(af.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		var tag reflect.StructTag
+		if af.Tag != nil {
+			s, err := strconv.Unquote(af.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		for _, ident := range af.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			f, err := pkg.parseField(ident.Name, af.Type, tag, generated)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, ident.Name, err)
+			}
+			if f == nil {
+				continue
+			}
+			if target, ok := sizeofMap[f.Name]; ok {
+				f.Sizefrom = target
+			}
+			if f.Sizeof != "" {
+				sizeofMap[f.Sizeof] = f.Name
+			}
+			if f.Sizefrom != "" {
+				source, ok := byName[f.Sizefrom]
+				if !ok || source.Slice || !intKind(source.Kind) {
+					return nil, fmt.Errorf("%s.%s: sizefrom=%s must be an earlier integer field", name, f.Name, f.Sizefrom)
+				}
+			}
+			if f.Type == "cstring" && f.Sizefrom != "" {
+				return nil, fmt.Errorf("%s.%s: cstring cannot use sizefrom", name, f.Name)
+			}
+			if f.Len == -1 && f.Sizefrom == "" {
+				return nil, fmt.Errorf("%s.%s: slice with no length or sizeof field", name, f.Name)
+			}
+			fields = append(fields, f)
+			byName[f.Name] = f
+		}
+	}
+	for _, f := range fields {
+		if f.Sizeof == "" {
+			continue
+		}
+		target, ok := byName[f.Sizeof]
+		if !ok || !(target.Slice || target.Kind == "string") || target.Type == "cstring" {
+			return nil, fmt.Errorf("%s.%s: sizeof=%s must be a slice, array or string field", name, f.Name, f.Sizeof)
+		}
+	}
+	return fields, nil
+}
+
+func (pkg *pkgInfo) parseField(name string, typ ast.Expr, tag reflect.StructTag, generated map[string]bool) (*field, error) {
+	t, err := parseStrucTag(tag)
+	if err != nil || t.Skip {
+		return nil, err
+	}
+	f := &field{Name: name, Len: 1, Order: t.Order, Sizeof: t.Sizeof, Sizefrom: t.Sizefrom}
+	arrayLen := 0
+	container := false
+	switch at := typ.(type) {
+	case *ast.ArrayType:
+		container = true
+		f.Slice = true
+		f.Len = -1
+		if at.Len != nil {
+			lit, ok := at.Len.(*ast.BasicLit)
+			if !ok || lit.Kind != token.INT {
+				return nil, fmt.Errorf("array length must be a literal")
+			}
+			n, err := strconv.ParseInt(lit.Value, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			f.Array = true
+			f.Len = int(n)
+			arrayLen = f.Len
+		}
+		typ = at.Elt
+	}
+	ident, ok := typ.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type")
+	}
+	f.Elem = ident.Name
+	if f.Kind, err = pkg.kind(ident.Name, generated); err != nil {
+		return nil, err
+	}
+	f.DefType = defTypes[f.Kind]
+
+	pureType := typeLenRe.ReplaceAllLiteralString(t.Type, "")
+	if alias, ok := typeAliases[pureType]; ok {
+		pureType = alias
+	}
+	if unsupportedTypes[pureType] {
+		return nil, fmt.Errorf("type %s is not supported", pureType)
+	}
+	if _, ok := typeSizes[pureType]; ok && pureType != "string" {
+		f.Type = pureType
+		f.Len = 1
+		if match := typeLenRe.FindStringSubmatch(t.Type); match != nil {
+			f.Slice = true
+			f.Len = -1
+			if match[1] != "" {
+				f.Len, _ = strconv.Atoi(match[1])
+			}
+		}
+		if f.Type == "cstring" {
+			if f.Kind != "string" && !(container && !f.Array && f.Kind == "uint8") {
+				return nil, fmt.Errorf("cstring must be a string or []byte")
+			}
+			if f.Slice = typeLenRe.MatchString(t.Type); f.Slice && f.Len < 1 {
+				return nil, fmt.Errorf("cstring needs a fixed [N] length")
+			}
+			if !f.Slice {
+				f.Len = 0
+			}
+		}
+	} else {
+		f.Type = f.DefType
+	}
+	if f.Array && f.Len > arrayLen {
+		return nil, fmt.Errorf("length %d is longer than its array", f.Len)
+	}
+	if f.Slice && !container && f.Kind != "string" && f.Type != "pad" {
+		return nil, fmt.Errorf("has a length but is not an array, slice or string")
+	}
+	if f.Sizeof != "" && (!intKind(f.Kind) || f.Slice) {
+		return nil, fmt.Errorf("sizeof field must be an integer")
+	}
+	return f, f.checkType()
+}
+
+// checkRecursion refuses struct types that contain themselves, which the
+// generated methods would unpack without struc's MaxDepth limit.
+func (pkg *pkgInfo) checkRecursion(names []string, structs map[string][]*field) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("%s is recursive, which is not supported", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, f := range structs[name] {
+			if f.Type == "struct" {
+				if err := visit(pkg.structName(f.Elem)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structName follows named types defined as other named types down to the
+// struct type.
+func (pkg *pkgInfo) structName(name string) string {
+	for i := 0; i < 100; i++ {
+		ident, ok := pkg.types[name].(*ast.Ident)
+		if !ok {
+			break
+		}
+		name = ident.Name
+	}
+	return name
+}
+
+// kind returns the underlying kind of a named type.
+func (pkg *pkgInfo) kind(name string, generated map[string]bool) (string, error) {
+	for i := 0; i < 100; i++ {
+		if kind, ok := builtinKinds[name]; ok {
+			return kind, nil
+		}
+		if _, ok := defTypes[name]; ok && name != "struct" {
+			return name, nil
+		}
+		expr, ok := pkg.types[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported type %s", name)
+		}
+		if m := pkg.methods[name]; m["Pack"] && m["Unpack"] && m["Size"] {
+			return "", fmt.Errorf("Custom type %s is not supported", name)
+		}
+		switch expr := expr.(type) {
+		case *ast.StructType:
+			if !generated[name] {
+				return "", fmt.Errorf("nested struct %s must also be generated", name)
+			}
+			return "struct", nil
+		case *ast.Ident:
+			name = expr.Name
+		default:
+			return "", fmt.Errorf("unsupported type %s", name)
+		}
+	}
+	return "", fmt.Errorf("type %s is too deeply nested", name)
+}
+
+// checkType follows struc's Field.checkType, also refusing combinations
+// that struc supports but strucgen doesn't.
+func (f *field) checkType() error {
+	switch f.Type {
+	case "pad", "cstring":
+		return nil
+	case "struct":
+		if f.Kind == "struct" {
+			return nil
+		}
+	case "string":
+		if f.Kind == "string" && !f.Slice {
+			return nil
+		}
+	case "float32", "float64":
+		if f.Kind == "float32" || f.Kind == "float64" {
+			return nil
+		}
+	default:
+		if f.Kind == "string" {
+			if f.Slice && f.Type == "uint8" {
+				return nil
+			}
+		} else if intKind(f.Kind) || f.Kind == "bool" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s cannot be packed as %s", f.Elem, f.Type)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+const strucPath = "github.com/lunixbochs/struc"
+
+// generate returns the source of a file holding the struc.Generated methods
+// for the named types.
+func generate(pkg *pkgInfo, names []string) ([]byte, error) {
+	generated := make(map[string]bool)
+	for _, name := range names {
+		generated[name] = true
+	}
+	structs := make(map[string][]*field)
+	for _, name := range names {
+		fields, err := pkg.structFields(name, generated)
+		if err != nil {
+			return nil, err
+		}
+		structs[name] = fields
+	}
+	if err := pkg.checkRecursion(names, structs); err != nil {
+		return nil, err
+	}
+	g := &generator{imports: map[string]bool{strucPath: true}}
+	for _, name := range names {
+		fields := structs[name]
+		g.genSize(name, fields)
+		g.genPack(name, fields)
+		g.genUnpack(name, fields)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by \"strucgen -type %s\"; DO NOT EDIT.\n\n", strings.Join(names, ","))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg.name)
+	var imports []string
+	for path := range g.imports {
+		if path != strucPath {
+			imports = append(imports, path)
+		}
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	fmt.Fprintf(&out, "\n\t%q\n)\n", strucPath)
+	out.Write(g.buf.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting output: %v\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+var byteOrders = map[string]string{
+	"big":    "BigEndian",
+	"little": "LittleEndian",
+}
+
+type generator struct {
+	buf     bytes.Buffer // method bodies
+	body    bytes.Buffer // the method being generated
+	imports map[string]bool
+	orders  map[string]bool // byte orders used by the current method
+	tmp     bool            // the current method reads into tmp
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+func (g *generator) use(path string) {
+	g.imports[path] = true
+}
+
+func (g *generator) order(f *field) string {
+	g.orders[f.Order] = true
+	g.use("encoding/binary")
+	return f.Order
+}
+
+// method wraps the generated body in a method declaration, declaring the
+// byte orders it used.
+func (g *generator) method(doc, decl string) {
+	fmt.Fprintf(&g.buf, "\n// %s\nfunc %s {\n", doc, decl)
+	if g.tmp {
+		fmt.Fprintf(&g.buf, "var tmp [8]byte\n")
+	}
+	if len(g.orders) > 0 {
+		var names, values []string
+		for _, order := range []string{"big", "little"} {
+			if g.orders[order] {
+				fmt.Fprintf(&g.buf, "var %s binary.ByteOrder = binary.%s\n", order, byteOrders[order])
+				names = append(names, order)
+				values = append(values, "opt.Order")
+			}
+		}
+		fmt.Fprintf(&g.buf, "if opt != nil && opt.Order != nil {\n%s = %s\n}\n",
+			strings.Join(names, ", "), strings.Join(values, ", "))
+	}
+	g.buf.Write(g.body.Bytes())
+	fmt.Fprintf(&g.buf, "}\n")
+	g.body.Reset()
+	g.orders = make(map[string]bool)
+	g.tmp = false
+}
+
+func (g *generator) genSize(name string, fields []*field) {
+	g.orders = make(map[string]bool)
+	g.printf("size := 0\n")
+	for _, f := range fields {
+		v := "s." + f.Name
+		switch {
+		case f.Type == "struct" && f.Slice:
+			g.printf("for i := range %s {\n", v)
+			g.printf("n, err := %s[i].StrucSize(opt)\nif err != nil {\nreturn 0, err\n}\nsize += n\n}\n", v)
+		case f.Type == "struct":
+			g.printf("if n, err := %s.StrucSize(opt); err != nil {\nreturn 0, err\n} else {\nsize += n\n}\n", v)
+		case f.Type == "pad":
+			g.printf("size += %d // %s\n", f.Len, f.Name)
+		case f.Type == "cstring" && f.Slice:
+			g.printf("size += %d // %s\n", f.Len, f.Name)
+		case f.Type == "cstring":
+			g.printf("size += len(%s) + 1\n", v)
+		case (f.Slice || f.Kind == "string") && f.Len > 1:
+			g.printf("size += %d // %s\n", f.Len*typeSizes[f.Type], f.Name)
+		case f.Slice || f.Kind == "string":
+			g.printf("size += len(%s)%s\n", v, times(typeSizes[f.Type]))
+		default:
+			g.printf("size += %d // %s\n", typeSizes[f.Type], f.Name)
+		}
+	}
+	g.printf("return size, nil\n")
+	g.method("StrucSize returns the packed size of s.",
+		fmt.Sprintf("(s *%s) StrucSize(opt *struc.Options) (int, error)", name))
+}
+
+func times(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return fmt.Sprintf(" * %d", n)
+}
+
+// length emits code setting n to the number of elements to pack or unpack.
+func (g *generator) length(f *field, fields []*field, pack bool) {
+	if f.Sizefrom != "" {
+		var source *field
+		for _, sf := range fields {
+			if sf.Name == f.Sizefrom {
+				source = sf
+			}
+		}
+		v := "s." + source.Name
+		g.use("fmt")
+		if strings.HasPrefix(source.Kind, "int") {
+			g.printf("n := int(%s)\nif n < 0 || int64(n) != int64(%s) {\n", v, v)
+		} else {
+			g.printf("n := int(%s)\nif n < 0 || uint64(n) != uint64(%s) {\n", v, v)
+		}
+		g.printf("return %sfmt.Errorf(\"sizeof field `%s` holds invalid length %%v\", %s)\n}\n", errPrefix(pack), source.Name, v)
+		if pack && f.Slice {
+			g.printf("if n == 0 {\nn = len(s.%s)\n}\n", f.Name)
+		}
+		return
+	}
+	if pack && f.Slice && f.Len <= 0 {
+		g.printf("n := len(s.%s)\n", f.Name)
+		return
+	}
+	g.printf("n := %d\n", f.Len)
+}
+
+func errPrefix(pack bool) string {
+	if pack {
+		return "pos, "
+	}
+	return ""
+}
+
+func (g *generator) short(n string) {
+	g.use("io")
+	g.printf("if len(buf)-pos < %s {\nreturn pos, io.ErrShortBuffer\n}\n", n)
+}
+
+func (g *generator) genPack(name string, fields []*field) {
+	g.orders = make(map[string]bool)
+	g.printf("pos := 0\n")
+	for _, f := range fields {
+		v := "s." + f.Name
+		g.printf("// %s\n{\n", f.Name)
+		switch {
+		case f.Type == "cstring":
+			g.packCString(f, v)
+		case f.Type == "pad":
+			g.length(f, fields, true)
+			g.short("n")
+			g.printf("for i := 0; i < n; i++ {\nbuf[pos+i] = 0\n}\npos += n\n")
+		case f.Slice && !f.Array && f.Type == "uint8" && (f.DefType == "uint8" || f.Kind == "string"):
+			// bytes are copied, padding with zeros up to the length
+			g.length(f, fields, true)
+			g.use("io")
+			g.printf("if len(buf)-pos < len(%s) || len(buf)-pos < n {\nreturn pos, io.ErrShortBuffer\n}\n", v)
+			g.printf("copy(buf[pos:], %s)\n", v)
+			g.printf("if len(%s) < n {\nfor i := len(%s); i < n; i++ {\nbuf[pos+i] = 0\n}\npos += n\n", v, v)
+			g.printf("} else {\npos += len(%s)\n}\n", v)
+		case f.Slice:
+			g.length(f, fields, true)
+			g.printf("var zero %s\nfor i := 0; i < n; i++ {\ne := &zero\nif i < len(%s) {\ne = &%s[i]\n}\n", f.Elem, v, v)
+			if f.Type == "struct" {
+				g.packVal(f, "e", f.Elem)
+			} else {
+				g.packVal(f, "*e", f.Elem)
+			}
+			g.printf("}\n")
+		case f.Sizeof != "":
+			g.packVal(f, fmt.Sprintf("len(s.%s)", f.Sizeof), "int")
+		default:
+			g.packVal(f, v, f.Elem)
+		}
+		g.printf("}\n")
+	}
+	g.printf("return pos, nil\n")
+	g.method("StrucPack packs s into buf, returning the number of bytes written.",
+		fmt.Sprintf("(s *%s) StrucPack(buf []byte, opt *struc.Options) (int, error)", name))
+}
+
+func (g *generator) packCString(f *field, v string) {
+	g.use("fmt")
+	if f.Kind == "string" {
+		g.use("strings")
+		g.printf("if strings.IndexByte(%s, 0) >= 0 {\n", v)
+	} else {
+		g.use("bytes")
+		g.printf("if bytes.IndexByte(%s, 0) >= 0 {\n", v)
+	}
+	g.printf("return pos, fmt.Errorf(\"cstring field `%s` contains a NUL byte\")\n}\n", f.Name)
+	g.printf("size := len(%s) + 1\n", v)
+	if f.Slice {
+		g.printf("if size > %d {\n", f.Len)
+		g.printf("return pos, fmt.Errorf(\"cstring field `%s` is too long: %%d bytes + NUL > %d\", len(%s))\n}\n", f.Name, f.Len, v)
+		g.printf("size = %d\n", f.Len)
+	}
+	g.short("size")
+	g.printf("copy(buf[pos:], %s)\n", v)
+	g.printf("for i := len(%s); i < size; i++ {\nbuf[pos+i] = 0\n}\npos += size\n", v)
+}
+
+// packVal emits code packing the scalar, string or struct v, whose Go
+// type is goType.
+func (g *generator) packVal(f *field, v, goType string) {
+	switch f.Type {
+	case "struct":
+		g.printf("m, err := %s.StrucPack(buf[pos:], opt)\nif err != nil {\nreturn pos, err\n}\npos += m\n", v)
+		return
+	case "string":
+		g.short(fmt.Sprintf("len(%s)", v))
+		g.printf("pos += copy(buf[pos:], %s)\n", v)
+		return
+	}
+	size := typeSizes[f.Type]
+	g.short(fmt.Sprint(size))
+	if f.Kind == "bool" {
+		if f.Type == "bool" {
+			g.printf("if %s {\nbuf[pos] = 1\n} else {\nbuf[pos] = 0\n}\npos += 1\n", v)
+			return
+		}
+		g.printf("var x uint8\nif %s {\nx = 1\n}\n", v)
+		v, goType = "x", "uint8"
+	}
+	switch f.Type {
+	case "float32":
+		g.use("math")
+		v, goType = fmt.Sprintf("math.Float32bits(%s)", convert("float32", v, goType)), "uint32"
+	case "float64":
+		g.use("math")
+		v, goType = fmt.Sprintf("math.Float64bits(%s)", convert("float64", v, goType)), "uint64"
+	}
+	switch f.Type {
+	case "bool":
+		g.printf("if %s != 0 {\nbuf[pos] = 1\n} else {\nbuf[pos] = 0\n}\n", v)
+	case "int8", "uint8":
+		g.printf("buf[pos] = %s\n", convert("byte", v, goType))
+	case "int16", "uint16":
+		g.printf("%s.PutUint16(buf[pos:], %s)\n", g.order(f), convert("uint16", v, goType))
+	case "int32", "uint32", "float32":
+		g.printf("%s.PutUint32(buf[pos:], %s)\n", g.order(f), convert("uint32", v, goType))
+	case "int64", "uint64", "float64":
+		g.printf("%s.PutUint64(buf[pos:], %s)\n", g.order(f), convert("uint64", v, goType))
+	}
+	g.printf("pos += %d\n", size)
+}
+
+// convert returns v, of Go type from, converted to type to.
+func convert(to, v, from string) string {
+	if to == from || (to == "byte" && from == "uint8") {
+		return v
+	}
+	return fmt.Sprintf("%s(%s)", to, v)
+}
+
+func (g *generator) genUnpack(name string, fields []*field) {
+	g.orders = make(map[string]bool)
+	for _, f := range fields {
+		v := "s." + f.Name
+		g.printf("// %s\n{\n", f.Name)
+		if f.Slice || f.Sizefrom != "" {
+			g.length(f, fields, false)
+		}
+		if f.Sizefrom != "" {
+			g.printf("if opt != nil && opt.MaxSliceLen > 0 && n > opt.MaxSliceLen {\n")
+			g.printf("return &struc.LimitError{Limit: \"MaxSliceLen\", Max: opt.MaxSliceLen, Value: int64(n)}\n}\n")
+		}
+		if f.Array && f.Sizefrom != "" {
+			g.use("fmt")
+			g.printf("if n > len(%s) {\nreturn fmt.Errorf(\"length %%d exceeds array length %%d\", n, len(%s))\n}\n", v, v)
+		}
+		switch {
+		case f.Type == "struct" && f.Slice && !f.Array:
+			g.printf("if cap(%s) >= n {\n%s = %s[:0]\n} else if n > %d {\n", v, v, v, maxPrealloc)
+			g.printf("%s = make([]%s, 0, %d)\n} else {\n%s = make([]%s, 0, n)\n}\n", v, f.Elem, maxPrealloc, v, f.Elem)
+			g.printf("for i := 0; i < n; i++ {\n%s = append(%s, %s{})\n", v, v, f.Elem)
+			g.printf("if err := %s[i].StrucUnpack(r, opt); err != nil {\nreturn err\n}\n}\n", v)
+		case f.Type == "struct" && f.Slice:
+			g.printf("for i := 0; i < n; i++ {\n")
+			g.printf("if err := %s[i].StrucUnpack(r, opt); err != nil {\nreturn err\n}\n}\n", v)
+		case f.Type == "struct":
+			g.printf("if err := %s.StrucUnpack(r, opt); err != nil {\nreturn err\n}\n", v)
+		case f.Type == "cstring" && !f.Slice:
+			g.unpackCString(f, v)
+		default:
+			g.unpackBytes(f, v)
+		}
+		g.printf("}\n")
+	}
+	g.printf("return nil\n")
+	g.method("StrucUnpack unpacks s from r.",
+		fmt.Sprintf("(s *%s) StrucUnpack(r io.Reader, opt *struc.Options) error", name))
+	g.use("io")
+}
+
+// maxPrealloc matches struc's limit on slice elements allocated before
+// they are read.
+const maxPrealloc = 1024
+
+func (g *generator) unpackCString(f *field, v string) {
+	g.tmp = true
+	g.use("io")
+	g.printf("var data []byte\nfor {\n")
+	g.printf("if opt != nil && opt.MaxSliceLen > 0 && len(data) >= opt.MaxSliceLen {\n")
+	g.printf("return &struc.LimitError{Limit: \"MaxSliceLen\", Max: opt.MaxSliceLen, Value: int64(len(data) + 1)}\n}\n")
+	g.printf("b, err := struc.ReadN(r, 1, tmp[:])\nif err == io.EOF {\nerr = io.ErrUnexpectedEOF\n}\n")
+	g.printf("if err != nil {\nreturn err\n}\nif b[0] == 0 {\nbreak\n}\ndata = append(data, b[0])\n}\n")
+	g.setCString(f, v, "data")
+}
+
+func (g *generator) setCString(f *field, v, data string) {
+	if f.Kind == "string" {
+		g.printf("%s = string(%s)\n", v, data)
+	} else {
+		g.printf("%s = append([]byte{}, %s...)\n", v, data)
+	}
+}
+
+// unpackBytes emits code reading n elements of f's type and storing them.
+func (g *generator) unpackBytes(f *field, v string) {
+	g.tmp = true
+	size := typeSizes[f.Type]
+	n := fmt.Sprint(f.Len * size)
+	if f.Slice || f.Sizefrom != "" {
+		n = "n" + times(size)
+	}
+	if f.Sizefrom != "" && size > 1 {
+		g.use("fmt")
+		g.printf("if n > int(^uint(0)>>1)/%d {\nreturn fmt.Errorf(\"length %%d is too large\", n)\n}\n", size)
+	}
+	if f.Type == "pad" {
+		g.printf("if _, err := struc.ReadN(r, %s, tmp[:]); err != nil {\nreturn err\n}\n", n)
+		return
+	}
+	g.printf("b, err := struc.ReadN(r, %s, tmp[:])\nif err != nil {\nreturn err\n}\n", n)
+	switch {
+	case f.Type == "cstring":
+		g.use("bytes")
+		g.printf("if i := bytes.IndexByte(b, 0); i >= 0 {\nb = b[:i]\n}\n")
+		g.setCString(f, v, "b")
+	case f.Kind == "string":
+		g.printf("%s = string(b)\n", v)
+	case f.Slice:
+		if !f.Array {
+			g.printf("if cap(%s) < n {\n%s = make([]%s, n)\n} else if len(%s) < n {\n%s = %s[:n]\n}\n",
+				v, v, f.Elem, v, v, v)
+		}
+		if !f.Array && f.Type == "uint8" && f.DefType == "uint8" {
+			g.printf("copy(%s, b[:n])\n", v)
+		} else {
+			g.printf("for i := 0; i < n; i++ {\n%s[i] = %s\n}\n", v, g.unpackVal(f, "i"))
+		}
+	default:
+		g.printf("%s = %s\n", v, g.unpackVal(f, ""))
+	}
+}
+
+// unpackVal returns an expression decoding element i (or the only value, if
+// i is empty) of f's type from b, converted to f's element type.
+func (g *generator) unpackVal(f *field, i string) string {
+	size := typeSizes[f.Type]
+	b := "b"
+	if i != "" && size > 1 {
+		b = fmt.Sprintf("b[%s*%d:]", i, size)
+	}
+	var raw, rawType string
+	switch f.Type {
+	case "bool", "int8", "uint8":
+		if i == "" {
+			i = "0"
+		}
+		raw, rawType = fmt.Sprintf("b[%s]", i), "uint8"
+	case "int16", "uint16":
+		raw, rawType = fmt.Sprintf("%s.Uint16(%s)", g.order(f), b), "uint16"
+	case "int32", "uint32", "float32":
+		raw, rawType = fmt.Sprintf("%s.Uint32(%s)", g.order(f), b), "uint32"
+	case "int64", "uint64", "float64":
+		raw, rawType = fmt.Sprintf("%s.Uint64(%s)", g.order(f), b), "uint64"
+	}
+	switch f.Type {
+	case "float32":
+		g.use("math")
+		raw, rawType = fmt.Sprintf("math.Float32frombits(%s)", raw), "float32"
+	case "float64":
+		g.use("math")
+		raw, rawType = fmt.Sprintf("math.Float64frombits(%s)", raw), "float64"
+	case "int8", "int16", "int32", "int64":
+		// sign extend before converting
+		raw, rawType = convert(f.Type, raw, rawType), f.Type
+	}
+	if f.Kind == "bool" {
+		return raw + " != 0"
+	}
+	return convert(f.Elem, raw, rawType)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	const out = "example/header_struc.go"
+	pkg, err := parsePackage("example", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(pkg, []string{"Header", "Section", "Point"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Fatalf("%s is stale; run go generate ./cmd/strucgen/example", out)
+	}
+}
+
+func parseSource(t *testing.T, src string) *pkgInfo {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "src.go", "package p\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := newPackage([]*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+var badTypes = []struct {
+	src, err string
+}{
+	{"type T struct { A int `struc:\"int8:4\"`}", "bitfields"},
+	{"type T struct { A, B int `struc:\"int8,if=A\"`}", "if="},
+	{"type T struct { A int `struc:\"int8,offset=4\"`}", "offset="},
+	{"type T struct { A int `struc:\"int8,const=4\"`}", "const="},
+	{"type T struct { A, B int `struc:\"int8,checksum=crc32\"`}", "checksum="},
+	{"type T struct { N int `struc:\"int8,bytesizeof=A\"`; A []int32 }", "bytesizeof="},
+	{"type T struct { A int `struc:\"uvarint\"`}", "not supported"},
+	{"type T struct { A int `struc:\"size_t\"`}", "not supported"},
+	{"type T struct { A *int }", "unsupported"},
+	{"type T struct { A []byte }", "slice with no length"},
+	{"type T struct { A int `struc:\"[2]int8\"`}", "not an array"},
+	{"type T struct { A [2]int `struc:\"[4]int8\"`}", "longer than its array"},
+	{"type T struct { A float64 `struc:\"int8\"`}", "cannot be packed"},
+	{"type T struct { N int `struc:\"sizeof=A\"`; A int }", "sizeof=A"},
+	{"type T struct { A []byte `struc:\"sizefrom=N\"`; N int }", "sizefrom=N"},
+	{"type T struct { U U }; type U struct { A int }", "must also be generated"},
+	{"type T struct { N int `struc:\"int8,sizeof=C\"`; C []T }", "recursive"},
+	{"type T struct { C C }; type C int\n" +
+		"func (C) Pack() {}; func (C) Unpack() {}; func (C) Size() {}", "Custom"},
+	{"type T int", "not a struct"},
+}
+
+func TestBadTypes(t *testing.T) {
+	for _, bt := range badTypes {
+		_, err := generate(parseSource(t, bt.src), []string{"T"})
+		if err == nil || !strings.Contains(err.Error(), bt.err) {
+			t.Errorf("%s: expected error containing %q, got %v", bt.src, bt.err, err)
+		}
+	}
+	// mutually recursive types listed together
+	src := "type T struct { N int `struc:\"int8,sizeof=U\"`; U []U }; type U struct { T T }"
+	if _, err := generate(parseSource(t, src), []string{"T", "U"}); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("expected a recursive type error, got %v", err)
+	}
+}
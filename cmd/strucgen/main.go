@@ -0,0 +1,141 @@
+// Command strucgen writes reflection-free StrucSize, StrucPack and
+// StrucUnpack methods for structs with struc tags, implementing
+// struc.Generated. struc.Pack, struc.Unpack and struc.Sizeof use these
+// methods instead of reflection.
+//
+// Run it from go:generate next to the struct definitions:
+//
+//	//go:generate go run github.com/lunixbochs/struc/cmd/strucgen -type Header,Section
+//
+// By default the methods are written to <type>_struc.go in the package
+// directory, named after the first type. Nested struct types must be listed
+// too. strucgen supports scalars, byte order, pad, cstring, strings, arrays,
+// slices, sizeof= and sizefrom=; it refuses types using bitfields, if=,
+// switch=, align=, offset=, const=, magic=, checksum=, bytesizeof=,
+// bytesizefrom=, varints, Size_t/Off_t, pointers, Custom types or recursive
+// types.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default <dir>/<type>_struc.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: strucgen -type T[,T...] [-output file] [dir]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("strucgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	outName := *output
+	if outName == "" {
+		outName = filepath.Join(dir, strings.ToLower(types[0])+"_struc.go")
+	}
+	pkg, err := parsePackage(dir, outName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := generate(pkg, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pkgInfo holds the type declarations of a parsed package.
+type pkgInfo struct {
+	name    string
+	types   map[string]ast.Expr
+	methods map[string]map[string]bool
+}
+
+// parsePackage parses the non-test Go files in dir, ignoring the file
+// strucgen is about to overwrite.
+func parsePackage(dir, skip string) (*pkgInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || filepath.Clean(path) == filepath.Clean(skip) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return newPackage(files)
+}
+
+func newPackage(files []*ast.File) (*pkgInfo, error) {
+	pkg := &pkgInfo{
+		name:    files[0].Name.Name,
+		types:   make(map[string]ast.Expr),
+		methods: make(map[string]map[string]bool),
+	}
+	for _, f := range files {
+		if f.Name.Name != pkg.name {
+			return nil, fmt.Errorf("found packages %s and %s", pkg.name, f.Name.Name)
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.TypeSpec); ok {
+						pkg.types[spec.Name.Name] = spec.Type
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || len(decl.Recv.List) != 1 {
+					continue
+				}
+				recv := decl.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); ok {
+					if pkg.methods[ident.Name] == nil {
+						pkg.methods[ident.Name] = make(map[string]bool)
+					}
+					pkg.methods[ident.Name][decl.Name.Name] = true
+				}
+			}
+		}
+	}
+	return pkg, nil
+}
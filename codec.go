@@ -0,0 +1,108 @@
+//go:build go1.21
+
+package struc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// A Codec packs and unpacks values of struct type T. The fields and options
+// are resolved once by For, so its methods skip the per-call lookups of the
+// interface{} functions. A Codec is safe for concurrent use.
+type Codec[T any] struct {
+	packer  Packer
+	options Options
+}
+
+// For returns a Codec for struct type T with options, which may be nil. It
+// fails if T is not a struct struc can pack or the options are invalid.
+func For[T any](options *Options) (*Codec[T], error) {
+	c := &Codec[T]{}
+	if options != nil {
+		c.options = *options
+	}
+	if err := c.options.Validate(); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struc: Codec type %v is not a struct", t)
+	}
+	fields, err := parseFields(reflect.New(t))
+	if err != nil {
+		return nil, err
+	}
+	c.packer = fields
+	if reflect.PtrTo(t).Implements(generatedType) {
+		c.packer = generatedPacker{fields}
+	}
+	return c, nil
+}
+
+func (c *Codec[T]) value(v *T) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Value{}, fmt.Errorf("struc: Codec got a nil %T", v)
+	}
+	return reflect.ValueOf(v).Elem(), nil
+}
+
+// Size returns the packed size of v.
+func (c *Codec[T]) Size(v *T) (int, error) {
+	val, err := c.value(v)
+	if err != nil {
+		return 0, err
+	}
+	return c.packer.Sizeof(val, &c.options)
+}
+
+// Pack packs v to w.
+func (c *Codec[T]) Pack(w io.Writer, v *T) error {
+	val, err := c.value(v)
+	if err != nil {
+		return err
+	}
+	return pack(w, val, c.packer, &c.options)
+}
+
+// PackInto packs v into the start of buf like PackInto.
+func (c *Codec[T]) PackInto(buf []byte, v *T) (int, error) {
+	val, err := c.value(v)
+	if err != nil {
+		return 0, err
+	}
+	return packInto(buf, val, c.packer, &c.options)
+}
+
+// Append appends the packed form of v to dst like AppendPack.
+func (c *Codec[T]) Append(dst []byte, v *T) ([]byte, error) {
+	val, err := c.value(v)
+	if err != nil {
+		return dst, err
+	}
+	return appendPack(dst, val, c.packer, &c.options)
+}
+
+// Unpack unpacks a T from r.
+func (c *Codec[T]) Unpack(r io.Reader) (T, error) {
+	var v T
+	err := c.UnpackInto(r, &v)
+	return v, err
+}
+
+// UnpackInto unpacks r into an existing v, which may reuse its slices.
+func (c *Codec[T]) UnpackInto(r io.Reader, v *T) error {
+	val, err := c.value(v)
+	if err != nil {
+		return err
+	}
+	return unpack(r, val, c.packer, &c.options)
+}
+
+// UnpackBytes unpacks a T from buf, returning the number of bytes consumed.
+func (c *Codec[T]) UnpackBytes(buf []byte) (T, int, error) {
+	var v T
+	n, err := unpackBytes(buf, reflect.ValueOf(&v).Elem(), c.packer, &c.options)
+	return v, n, err
+}
@@ -0,0 +1,116 @@
+//go:build go1.21
+
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestCodecFor(t *testing.T) {
+	c, err := For[Example](nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.Pack(&buf, reference); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), referenceBytes) {
+		t.Fatalf("got % x, want % x", buf.Bytes(), referenceBytes)
+	}
+	if size, err := c.Size(reference); err != nil || size != len(referenceBytes) {
+		t.Fatalf("Size: %d, %v", size, err)
+	}
+	out, err := c.Unpack(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, reference) {
+		t.Fatalf("got %#v, want %#v", out, reference)
+	}
+
+	dst, err := c.Append([]byte{0xff}, reference)
+	if err != nil || !bytes.Equal(dst[1:], referenceBytes) || dst[0] != 0xff {
+		t.Fatalf("Append: % x, %v", dst, err)
+	}
+	into := make([]byte, len(referenceBytes)+1)
+	if n, err := c.PackInto(into, reference); err != nil || n != len(referenceBytes) {
+		t.Fatalf("PackInto: %d, %v", n, err)
+	}
+	out, n, err := c.UnpackBytes(into)
+	if err != nil || n != len(referenceBytes) || !reflect.DeepEqual(&out, reference) {
+		t.Fatalf("UnpackBytes: %d, %v", n, err)
+	}
+}
+
+func TestCodecOptions(t *testing.T) {
+	type pair struct {
+		A, B uint16
+	}
+	options := &Options{Order: binary.LittleEndian}
+	c, err := For[pair](options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// later changes to options don't affect the Codec
+	options.Order = binary.BigEndian
+	dst, err := c.Append(nil, &pair{1, 2})
+	if err != nil || !bytes.Equal(dst, []byte{1, 0, 2, 0}) {
+		t.Fatalf("got % x, %v", dst, err)
+	}
+	if err := c.Pack(&bytes.Buffer{}, nil); err == nil {
+		t.Fatal("expected an error packing nil")
+	}
+}
+
+func TestCodecForInvalid(t *testing.T) {
+	type badField struct {
+		A chan int
+	}
+	if _, err := For[int](nil); err == nil {
+		t.Error("expected an error for a non-struct type")
+	}
+	if _, err := For[*Example](nil); err == nil {
+		t.Error("expected an error for a pointer type")
+	}
+	if _, err := For[badField](nil); err == nil {
+		t.Error("expected an error for an unsupported field")
+	}
+	if _, err := For[Example](&Options{PtrSize: 7}); err == nil {
+		t.Error("expected an error for invalid options")
+	}
+}
+
+func BenchmarkCodecPackInto(b *testing.B) {
+	c, err := For[BenchStrucExample](nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	for i := 0; i < b.N; i++ {
+		if _, err := c.PackInto(buf, benchStrucRef); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCodecUnpackBytes(b *testing.B) {
+	c, err := For[BenchStrucExample](nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := c.PackInto(buf, benchStrucRef)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf = buf[:n]
+	for i := 0; i < b.N; i++ {
+		if _, _, err := c.UnpackBytes(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// condition is a parsed `if=` expression, testing an earlier field
+// against a constant: `if=Flags`, `if=!Flags`, `if=Flags&4`, `if=Version>=2`
+type condition struct {
+	index  []int
+	not    bool
+	op     string
+	value  int64
+	signed bool
+}
+
+var conditionRe = regexp.MustCompile(`^\s*(!?)\s*(\w+)\s*(?:(==|!=|>=|<=|>|<|&)\s*(\S+))?\s*$`)
+
+func parseCondition(t reflect.Type, expr string, i int) (*condition, error) {
+	match := conditionRe.FindStringSubmatch(expr)
+	if match == nil || (match[1] != "" && match[3] != "") {
+		return nil, fmt.Errorf("invalid condition `if=%s`", expr)
+	}
+	source, ok := t.FieldByName(match[2])
+	if !ok {
+		return nil, fmt.Errorf("`if=%s` field does not exist", expr)
+	}
+	if source.Index[0] >= i {
+		return nil, fmt.Errorf("`if=%s` must refer to an earlier field", expr)
+	}
+	c := &condition{index: source.Index, not: match[1] != "", op: match[3]}
+	var err error
+	switch source.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.signed = true
+		if c.op != "" {
+			c.value, err = strconv.ParseInt(match[4], 0, 64)
+		}
+	case reflect.Bool, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if c.op != "" {
+			var n uint64
+			n, err = strconv.ParseUint(match[4], 0, 64)
+			c.value = int64(n)
+		}
+	default:
+		return nil, fmt.Errorf("`if=%s` field is not a bool or integer", expr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid constant in `if=%s`", expr)
+	}
+	return c, nil
+}
+
+func (c *condition) eval(val reflect.Value) bool {
+	field := val.FieldByIndex(c.index)
+	var n int64
+	switch field.Kind() {
+	case reflect.Bool:
+		if field.Bool() {
+			n = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = field.Int()
+	default:
+		n = int64(field.Uint())
+	}
+	less := n < c.value
+	if !c.signed {
+		less = uint64(n) < uint64(c.value)
+	}
+	switch c.op {
+	case "==":
+		return n == c.value
+	case "!=":
+		return n != c.value
+	case ">=":
+		return !less
+	case "<=":
+		return less || n == c.value
+	case ">":
+		return !less && n != c.value
+	case "<":
+		return less
+	case "&":
+		return n&c.value != 0
+	}
+	return (n != 0) != c.not
+}
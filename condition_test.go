@@ -0,0 +1,102 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type conditionHeader struct {
+	Version  int    `struc:"uint8"`
+	Flags    uint8  `struc:"uint8"`
+	Extended uint32 `struc:"uint32,if=Flags&4"`
+	V2       int    `struc:"int16,if=Version>=2"`
+	V1       int    `struc:"int16,if=Version<2"`
+	Size     int    `struc:"uint8,sizeof=Data,if=!Flags"`
+	Data     []byte `struc:"if=Flags==0"`
+	Tail     uint8
+}
+
+func TestConditionCodec(t *testing.T) {
+	tests := []struct {
+		val   *conditionHeader
+		bytes []byte
+	}{
+		{
+			&conditionHeader{Version: 1, Flags: 4, Extended: 0xdeadbeef, V1: 7, Tail: 9},
+			[]byte{1, 4, 0xde, 0xad, 0xbe, 0xef, 0, 7, 9},
+		},
+		{
+			&conditionHeader{Version: 2, Flags: 1, V2: 8, Tail: 9},
+			[]byte{2, 1, 0, 8, 9},
+		},
+		{
+			&conditionHeader{Version: 2, V2: 8, Size: 3, Data: []byte("abc"), Tail: 9},
+			[]byte{2, 0, 0, 8, 3, 'a', 'b', 'c', 9},
+		},
+	}
+	for _, test := range tests {
+		size, err := Sizeof(test.val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(test.bytes) {
+			t.Fatalf("sizeof failed; expected %d, got %d", len(test.bytes), size)
+		}
+		var buf bytes.Buffer
+		if err := Pack(&buf, test.val); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.bytes) {
+			t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), test.bytes)
+		}
+		// skipped fields are zeroed, even if the struct is reused
+		out := &conditionHeader{Extended: 1, V1: 2, V2: 3}
+		if err := Unpack(&buf, out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, test.val) {
+			t.Fatalf("got: %#v\nwant: %#v", out, test.val)
+		}
+	}
+}
+
+type conditionSkippedSize struct {
+	N    int    `struc:"uint16,sizeof=Data"`
+	F    bool   `struc:"bool"`
+	Data []byte `struc:"if=F"`
+}
+
+func TestConditionSkippedSizeof(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &conditionSkippedSize{Data: []byte{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	// the length of a skipped field is packed as 0
+	want := []byte{0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+}
+
+type conditionLater struct {
+	A int `struc:"if=B"`
+	B int
+}
+
+type conditionMissing struct {
+	A int `struc:"if=Missing>1"`
+}
+
+type conditionBadConst struct {
+	A uint8
+	B int `struc:"if=A==-1"`
+}
+
+func TestConditionParseErrors(t *testing.T) {
+	for _, v := range []interface{}{&conditionLater{}, &conditionMissing{}, &conditionBadConst{}} {
+		if err := parseTest(v); err == nil {
+			t.Fatalf("failed to error on bad condition in %T", v)
+		}
+	}
+}
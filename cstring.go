@@ -0,0 +1,81 @@
+package struc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// setCString validates a cstring field. A bare `cstring` is NUL-terminated
+// with no length limit, while `[N]cstring` is stored in a fixed N byte buffer.
+func (f *Field) setCString(t reflect.Type, fixed bool) error {
+	if t.Kind() != reflect.String && !(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8) {
+		return fmt.Errorf("cstring field `%s` must be a string or []byte", f.Name)
+	}
+	if fixed && f.Len < 1 {
+		return fmt.Errorf("cstring field `%s` needs a fixed [N] length", f.Name)
+	}
+	f.Slice = fixed
+	if !fixed {
+		f.Len = 0
+	}
+	return nil
+}
+
+func (f *Field) packCString(buf []byte, val reflect.Value) (int, error) {
+	var data []byte
+	if val.Kind() == reflect.String {
+		data = []byte(val.String())
+	} else {
+		data = val.Bytes()
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return 0, fmt.Errorf("cstring field `%s` contains a NUL byte", f.Name)
+	}
+	size := len(data) + 1
+	if f.Slice {
+		if size > f.Len {
+			return 0, fmt.Errorf("cstring field `%s` is too long: %d bytes + NUL > %d", f.Name, len(data), f.Len)
+		}
+		size = f.Len
+	}
+	copy(buf, data)
+	for i := len(data); i < size; i++ {
+		buf[i] = 0
+	}
+	return size, nil
+}
+
+func (f *Field) unpackCString(buf []byte, val reflect.Value) {
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	if val.Kind() == reflect.String {
+		val.SetString(string(buf))
+	} else {
+		val.SetBytes(append([]byte{}, buf...))
+	}
+}
+
+// readCString reads bytes up to and including a NUL terminator, failing
+// after max bytes if max > 0.
+func readCString(r io.Reader, max int) ([]byte, error) {
+	var out []byte
+	var tmp [1]byte
+	for {
+		if max > 0 && len(out) >= max {
+			return nil, &LimitError{Limit: "MaxSliceLen", Max: max, Value: int64(len(out) + 1)}
+		}
+		if _, err := io.ReadFull(r, tmp[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if tmp[0] == 0 {
+			return out, nil
+		}
+		out = append(out, tmp[0])
+	}
+}
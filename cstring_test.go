@@ -0,0 +1,87 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type cstringExample struct {
+	Name  string `struc:"[8]cstring"`
+	Label []byte `struc:"cstring"`
+	Path  string `struc:"cstring"`
+	Tail  uint8
+}
+
+var cstringRef = &cstringExample{
+	Name:  "abc",
+	Label: []byte("xy"),
+	Path:  "/tmp",
+	Tail:  9,
+}
+
+var cstringRefBytes = []byte{
+	'a', 'b', 'c', 0, 0, 0, 0, 0,
+	'x', 'y', 0,
+	'/', 't', 'm', 'p', 0,
+	9,
+}
+
+func TestCStringCodec(t *testing.T) {
+	size, err := Sizeof(cstringRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(cstringRefBytes) {
+		t.Fatalf("sizeof failed; expected %d, got %d", len(cstringRefBytes), size)
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, cstringRef); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), cstringRefBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), cstringRefBytes)
+	}
+	out := &cstringExample{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, cstringRef) {
+		t.Fatalf("got: %#v\nwant: %#v", out, cstringRef)
+	}
+}
+
+func TestCStringFixedGarbage(t *testing.T) {
+	// bytes after the terminator of a fixed buffer are ignored
+	in := []byte{'a', 'b', 0, 'z', 'z', 'z', 'z', 'z', 0, 0, 9}
+	out := &cstringExample{}
+	if err := Unpack(bytes.NewReader(in), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "ab" {
+		t.Fatalf("got %q, want %q", out.Name, "ab")
+	}
+}
+
+func TestCStringErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &cstringExample{Name: "12345678"}); err == nil {
+		t.Fatal("failed to error on cstring without room for NUL")
+	}
+	if err := Pack(&buf, &cstringExample{Path: "a\x00b"}); err == nil {
+		t.Fatal("failed to error on cstring containing NUL")
+	}
+	if err := Unpack(bytes.NewReader([]byte("abc\x00\x00\x00\x00\x00ab")), &cstringExample{}); err == nil {
+		t.Fatal("failed to error on unterminated cstring")
+	}
+}
+
+type cstringBadKind struct {
+	A int `struc:"cstring"`
+}
+
+func TestCStringParseErrors(t *testing.T) {
+	if err := parseTest(&cstringBadKind{}); err == nil {
+		t.Fatal("failed to error on cstring int field")
+	}
+}
@@ -24,8 +24,8 @@ func (c customFallback) Unpack(r io.Reader, val reflect.Value, opt *Options) err
 	return c.custom.Unpack(r, 1, opt)
 }
 
-func (c customFallback) Sizeof(val reflect.Value, opt *Options) int {
-	return c.custom.Size(opt)
+func (c customFallback) Sizeof(val reflect.Value, opt *Options) (int, error) {
+	return c.custom.Size(opt), nil
 }
 
 func (c customFallback) String() string {
@@ -0,0 +1,379 @@
+package struc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParseFormats compiles a textual schema into Formats, keyed by struct name.
+// names lists the structs in the order they were declared. A schema declares
+// structs whose fields each give a name, a type, optional struc tag options
+// and an optional constant value:
+//
+//	struct Header {
+//		magic uint32 = 0xCAFEBABE;  // const=
+//		sig   [4]byte = "RIFF";     // magic=
+//		count uint16 little;
+//		flags uint8:4;
+//		mode  uint8:4;
+//		items [count]Item;          // count gets sizeof=items
+//		crc   uint32 checksum=crc32;
+//	}
+//
+//	struct Item { x int16; y int16; }
+//
+// Types are those of struc tags, names of other structs, and "string". A
+// type may be prefixed by an array length: [N] for a fixed length, or [f]
+// for a length stored in an earlier field f. Comments start with // or #.
+func ParseFormats(src string) (formats map[string]*Format, names []string, err error) {
+	toks, err := lexSchema(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &schemaParser{toks: toks}
+	var structs []*schemaStruct
+	byName := make(map[string]*schemaStruct)
+	for !p.done() {
+		s, err := p.parseStruct()
+		if err != nil {
+			return nil, nil, err
+		}
+		if byName[s.name] != nil {
+			return nil, nil, fmt.Errorf("struc: schema line %d: struct %s redeclared", s.line, s.name)
+		}
+		byName[s.name] = s
+		structs = append(structs, s)
+	}
+	if len(structs) == 0 {
+		return nil, nil, fmt.Errorf("struc: schema declares no structs")
+	}
+	formats = make(map[string]*Format, len(structs))
+	for _, s := range structs {
+		formats[s.name] = NewFormat()
+		names = append(names, s.name)
+	}
+	for _, s := range structs {
+		if err := s.resolve(byName); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkSchemaCycles(structs, byName); err != nil {
+		return nil, nil, err
+	}
+	for _, s := range structs {
+		f := formats[s.name]
+		for _, field := range s.fields {
+			tag := strings.Join(field.tag, ",")
+			if field.sub != "" {
+				f.Struct(field.name, tag, formats[field.sub])
+			} else {
+				f.Field(field.name, tag)
+			}
+		}
+	}
+	for _, s := range structs {
+		if _, err := formats[s.name].Type(); err != nil {
+			return nil, nil, fmt.Errorf("struc: schema struct %s: %s", s.name, strings.TrimPrefix(err.Error(), "struc: "))
+		}
+	}
+	return formats, names, nil
+}
+
+type schemaStruct struct {
+	name   string
+	line   int
+	fields []*schemaField
+}
+
+type schemaField struct {
+	name   string
+	line   int
+	length string // inside the brackets of an array type
+	array  bool
+	elem   string
+	sub    string // struct element type
+	tag    []string
+}
+
+var schemaTypeRe = regexp.MustCompile(`^(?:\[([^\]]*)\])?(.+)$`)
+var schemaNumRe = regexp.MustCompile(`^[0-9]+$`)
+
+// resolve builds the struc tags of the fields of s, linking struct element
+// types and array lengths stored in other fields.
+func (s *schemaStruct) resolve(structs map[string]*schemaStruct) error {
+	for i, field := range s.fields {
+		typ := field.elem
+		if structs[typ] != nil {
+			field.sub, typ = typ, ""
+		}
+		var opts []string
+		switch {
+		case !field.array:
+		case field.length == "" || schemaNumRe.MatchString(field.length):
+			typ = "[" + field.length + "]" + typ
+		default:
+			typ = "[]" + typ
+			j := s.index(field.length)
+			if j < 0 || j >= i {
+				return fmt.Errorf("struc: schema line %d: length field %s must be declared before %s", field.line, field.length, field.name)
+			}
+			count := s.fields[j]
+			if hasTagOption(count.tag, "sizeof=") {
+				// count already sizes another field
+				opts = append(opts, "sizefrom="+count.name)
+			} else {
+				count.tag = append(count.tag, "sizeof="+field.name)
+			}
+		}
+		field.tag = append(append([]string{typ}, opts...), field.tag...)
+	}
+	return nil
+}
+
+func (s *schemaStruct) index(name string) int {
+	for i, field := range s.fields {
+		if field.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasTagOption(tag []string, prefix string) bool {
+	for _, opt := range tag {
+		if strings.HasPrefix(opt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSchemaCycles rejects structs that contain themselves, which have no
+// finite size.
+func checkSchemaCycles(structs []*schemaStruct, byName map[string]*schemaStruct) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(s *schemaStruct) error
+	visit = func(s *schemaStruct) error {
+		switch state[s.name] {
+		case visiting:
+			return fmt.Errorf("struc: schema line %d: struct %s contains itself", s.line, s.name)
+		case done:
+			return nil
+		}
+		state[s.name] = visiting
+		for _, field := range s.fields {
+			if field.sub != "" {
+				if err := visit(byName[field.sub]); err != nil {
+					return err
+				}
+			}
+		}
+		state[s.name] = done
+		return nil
+	}
+	for _, s := range structs {
+		if err := visit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type schemaToken struct {
+	text string
+	line int
+}
+
+// lexSchema splits a schema into words, quoted strings and the punctuation
+// { } ; and =. A word may contain = and quoted strings, as in magic="MZ".
+func lexSchema(src string) ([]schemaToken, error) {
+	var toks []schemaToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}' || c == ';' || c == '=':
+			toks = append(toks, schemaToken{src[i : i+1], line})
+			i++
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n{};#", rune(src[i])) && !strings.HasPrefix(src[i:], "//") {
+				if src[i] == '"' {
+					end := quotedEnd(src, i)
+					if end < 0 {
+						return nil, fmt.Errorf("struc: schema line %d: unterminated string", line)
+					}
+					i = end
+					continue
+				}
+				i++
+			}
+			toks = append(toks, schemaToken{src[start:i], line})
+		}
+	}
+	return toks, nil
+}
+
+// quotedEnd returns the offset after the double-quoted string starting at
+// src[i], or -1 if it is unterminated.
+func quotedEnd(src string, i int) int {
+	for j := i + 1; j < len(src) && src[j] != '\n'; j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+type schemaParser struct {
+	toks []schemaToken
+	pos  int
+}
+
+func (p *schemaParser) done() bool {
+	return p.pos >= len(p.toks)
+}
+
+func (p *schemaParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.toks[p.pos].text
+}
+
+func (p *schemaParser) line() int {
+	if p.done() {
+		if len(p.toks) == 0 {
+			return 1
+		}
+		return p.toks[len(p.toks)-1].line
+	}
+	return p.toks[p.pos].line
+}
+
+func (p *schemaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("struc: schema line %d: %s", p.line(), fmt.Sprintf(format, args...))
+}
+
+func (p *schemaParser) next() string {
+	s := p.peek()
+	p.pos++
+	return s
+}
+
+func (p *schemaParser) expect(s string) error {
+	if p.done() {
+		return p.errorf("expected %q, found end of schema", s)
+	}
+	if got := p.peek(); got != s {
+		return p.errorf("expected %q, found %q", s, got)
+	}
+	p.pos++
+	return nil
+}
+
+// ident reads a struct or field name.
+func (p *schemaParser) ident(what string) (string, error) {
+	if p.done() {
+		return "", p.errorf("expected %s name, found end of schema", what)
+	}
+	if s := p.peek(); !formatNameRe.MatchString(s) {
+		return "", p.errorf("invalid %s name %q", what, s)
+	}
+	return p.next(), nil
+}
+
+func (p *schemaParser) parseStruct() (*schemaStruct, error) {
+	if err := p.expect("struct"); err != nil {
+		return nil, err
+	}
+	s := &schemaStruct{line: p.line()}
+	var err error
+	if s.name, err = p.ident("struct"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.peek() != "}" {
+		if p.done() {
+			return nil, p.errorf("struct %s is missing }", s.name)
+		}
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		if s.index(field.name) >= 0 {
+			return nil, fmt.Errorf("struc: schema line %d: field %s redeclared", field.line, field.name)
+		}
+		s.fields = append(s.fields, field)
+	}
+	p.next()
+	if p.peek() == ";" {
+		p.next()
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseField() (*schemaField, error) {
+	field := &schemaField{line: p.line()}
+	var err error
+	if field.name, err = p.ident("field"); err != nil {
+		return nil, err
+	}
+	switch typ := p.peek(); typ {
+	case "", ";", "=", "{", "}":
+		return nil, p.errorf("field %s has no type", field.name)
+	default:
+		m := schemaTypeRe.FindStringSubmatch(p.next())
+		if m == nil || strings.ContainsAny(m[2], "[]") {
+			return nil, p.errorf("field %s has invalid type %q", field.name, typ)
+		}
+		field.array = strings.HasPrefix(typ, "[")
+		field.length, field.elem = m[1], m[2]
+	}
+	for {
+		switch tok := p.peek(); tok {
+		case ";":
+			p.next()
+			return field, nil
+		case "=":
+			p.next()
+			value := p.next()
+			switch value {
+			case "", ";", "=", "{", "}":
+				return nil, p.errorf("field %s has no value after =", field.name)
+			}
+			if strings.HasPrefix(value, `"`) {
+				field.tag = append(field.tag, "magic="+value)
+			} else {
+				field.tag = append(field.tag, "const="+value)
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+			return field, nil
+		case "", "{", "}":
+			return nil, p.errorf("field %s is missing ;", field.name)
+		default:
+			field.tag = append(field.tag, p.next())
+		}
+	}
+}
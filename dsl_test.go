@@ -0,0 +1,112 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+# a container of points
+struct Header {
+	magic  uint32 = 0xCAFEBABE;
+	sig    [4]byte = "RIFF";
+	count  uint16 little;
+	flags  uint8:4;
+	mode   uint8:4;
+	name   [8]string;
+	items  [count]Item;   // count is filled in when packing
+	values [count]int8;
+	crc    uint32 checksum=crc32;
+};
+
+struct Item { x int16; y int16; }
+`
+
+type dslItem struct {
+	X, Y int16
+}
+
+type dslHeader struct {
+	Magic  uint32 `struc:"const=0xCAFEBABE"`
+	Sig    []byte `struc:"[4]uint8,magic=\"RIFF\""`
+	Count  uint16 `struc:"little,sizeof=Items"`
+	Flags  uint8  `struc:"uint8:4"`
+	Mode   uint8  `struc:"uint8:4"`
+	Name   string `struc:"[8]byte"`
+	Items  []dslItem
+	Values []int8 `struc:"sizefrom=Count"`
+	CRC    uint32 `struc:"checksum=crc32"`
+}
+
+func TestParseFormats(t *testing.T) {
+	formats, names, err := ParseFormats(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"Header", "Item"}) {
+		t.Fatalf("names %v", names)
+	}
+	static := &dslHeader{
+		Flags: 1, Mode: 2, Name: "test",
+		Items:  []dslItem{{1, 2}, {3, 4}},
+		Values: []int8{-1, 1},
+	}
+	var want bytes.Buffer
+	if err := Pack(&want, static); err != nil {
+		t.Fatal(err)
+	}
+	rec := Record{
+		"flags": 1, "mode": 2, "name": "test",
+		"items":  []Record{{"x": 1, "y": 2}, {"x": 3, "y": 4}},
+		"values": []int{-1, 1},
+	}
+	var got bytes.Buffer
+	if err := formats["Header"].Pack(&got, rec, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("got % x, want % x", got.Bytes(), want.Bytes())
+	}
+	out, err := formats["Header"].Unpack(&got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["count"] != uint16(2) || out["magic"] != uint32(0xCAFEBABE) || string(out["sig"].([]byte)) != "RIFF" {
+		t.Fatalf("unpacked %v", out)
+	}
+}
+
+func TestParseFormatsErrors(t *testing.T) {
+	tests := map[string]string{
+		``:                                              "no structs",
+		`struct A { x uint8 }`:                          "line 1: field x is missing ;",
+		`struct A { x; }`:                               "field x has no type",
+		`struct A { x uint8; x uint8; }`:                "field x redeclared",
+		"struct A { x uint8; }\nstruct A { }":           "line 2: struct A redeclared",
+		`struct A { x uint8 = ; }`:                      "no value after =",
+		`struct A { x [4]byte = "ab; }`:                 "unterminated string",
+		`struct A { d [n]byte; n uint8; }`:              "length field n must be declared before d",
+		`struct A { b B; } struct B { a A; }`:           "struct A contains itself",
+		`struct A { x uint12; }`:                        `struct A: Format field "x": unknown type`,
+		`struct A { x uint8 = 256; }`:                   "invalid const=256",
+		`struct A { x uint8 }; struct B { }`:            "missing ;",
+		`struct 1A { }`:                                 `invalid struct name "1A"`,
+		`struct A { x uint8;`:                           "struct A is missing }",
+		`struct A { x [2][2]int8; }`:                    "invalid type",
+		`struct A x uint8; }`:                           `expected "{"`,
+		`struct A { x uint8; } extra`:                   `expected "struct"`,
+		`struct A { n uint8; d [n]byte; e [n]uint16; }`: "",
+	}
+	for src, want := range tests {
+		_, _, err := ParseFormats(src)
+		if want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", src, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package struc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const dumpWidth = 16
+
+// Dump unpacks data from r like UnpackWithOptions, writing an annotated
+// hexdump of the bytes it consumed to w: one line per field with its offset,
+// raw bytes, path and decoded value. If unpacking fails, the fields decoded
+// before the error are still written, followed by any remaining bytes and
+// the error, which is returned.
+func Dump(w io.Writer, r io.Reader, data interface{}, options *Options) error {
+	return dump(w, r, data, options, nil)
+}
+
+// dump is Dump, naming fields after format if it isn't nil.
+func dump(w io.Writer, r io.Reader, data interface{}, options *Options, format *Format) error {
+	var raw bytes.Buffer
+	err := UnpackWithOptions(io.TeeReader(r, &raw), data, options)
+	d := dumper{w: bufio.NewWriter(w), raw: raw.Bytes(), end: raw.Len(), format: format}
+	if fe, ok := err.(*FieldError); ok && fe.Offset >= 0 && fe.Offset < int64(d.end) {
+		d.end = int(fe.Offset)
+	}
+	if format != nil {
+		err = format.error(err)
+	}
+	if schema, lerr := Layout(data, options); lerr == nil {
+		d.fields(schema.Fields, reflect.ValueOf(data))
+	} else if err == nil {
+		// not a struct
+		d.hex(0, len(d.raw), dumpValue(reflect.ValueOf(data)))
+	}
+	d.hex(d.pos, len(d.raw), "")
+	if err != nil {
+		d.printf("%08x  error: %v\n", len(d.raw), err)
+	}
+	if ferr := d.w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+type dumper struct {
+	w   *bufio.Writer
+	raw []byte
+	pos int // end of the bytes dumped so far
+	end int // end of the bytes known to be decoded
+
+	format *Format // names the fields, if dumping a Format
+}
+
+// fields dumps the leaf fields of val in packing order, stopping at the
+// first one that wasn't decoded. It returns false once it has stopped.
+func (d *dumper) fields(fields []*FieldLayout, val reflect.Value) bool {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		val = val.Elem()
+	}
+	for _, f := range fields {
+		var v reflect.Value
+		if strings.HasPrefix(f.Name, "[") {
+			var i int
+			fmt.Sscanf(f.Name, "[%d]", &i)
+			v = val.Index(i)
+		} else {
+			v = val.FieldByName(f.Name)
+		}
+		if f.Fields != nil {
+			if !d.fields(f.Fields, v) {
+				return false
+			}
+			continue
+		}
+		if f.ValueSize <= 0 {
+			continue
+		}
+		start, end := f.ValueOffset, f.ValueOffset+f.ValueSize
+		if end > d.end {
+			return false
+		}
+		if start < d.pos {
+			// bitfields share their storage bytes
+			d.printf("%8s  %-*s  %s\n", "", dumpWidth*3-1, "", d.label(f, v))
+			continue
+		}
+		d.hex(d.pos, start, "")
+		d.hex(start, end, d.label(f, v))
+	}
+	return true
+}
+
+func (d *dumper) label(f *FieldLayout, v reflect.Value) string {
+	path := f.Path
+	if d.format != nil {
+		path = d.format.path(path)
+	}
+	var label string
+	if v.CanInterface() {
+		label = path + " = " + dumpValue(v)
+	} else {
+		// a `_` placeholder for a magic number
+		label = fmt.Sprintf("%s = %q", path, d.raw[f.ValueOffset:f.ValueOffset+f.ValueSize])
+	}
+	if f.Bits == 1 {
+		label += fmt.Sprintf(" (bit %d)", f.BitShift)
+	} else if f.Bits > 0 {
+		// numbered like WriteCHeader, from the least significant bit
+		label += fmt.Sprintf(" (bits %d-%d)", f.BitShift+f.Bits-1, f.BitShift)
+	}
+	return label
+}
+
+// hex dumps raw[start:end], labelling the first line.
+func (d *dumper) hex(start, end int, label string) {
+	for off := start; off < end; off += dumpWidth {
+		line := d.raw[off:end]
+		if len(line) > dumpWidth {
+			line = line[:dumpWidth]
+		}
+		hex := make([]string, len(line))
+		for i, b := range line {
+			hex[i] = fmt.Sprintf("%02x", b)
+		}
+		d.printf("%08x  %-*s  %s\n", off, dumpWidth*3-1, strings.Join(hex, " "), label)
+		label = ""
+	}
+	if end > d.pos {
+		d.pos = end
+	}
+}
+
+func (d *dumper) printf(format string, args ...interface{}) {
+	d.w.WriteString(strings.TrimRight(fmt.Sprintf(format, args...), " \n") + "\n")
+}
+
+// dumpValue formats a decoded field value.
+func dumpValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.CanAddr() {
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("%q", v.Bytes())
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,71 @@
+package struc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	ref := &layoutExample{
+		Magic:  [4]byte{'S', 'T', 'R', 'C'},
+		A:      5,
+		B:      17,
+		Origin: layoutPoint{1, -1},
+		Points: []layoutPoint{{2, 3}, {4, 5}},
+		Tail:   0x01020304,
+		Name:   "namename",
+	}
+	packed, err := AppendPack(nil, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	v := &layoutExample{}
+	if err := Dump(&out, bytes.NewReader(packed), v, nil); err != nil {
+		t.Fatal(err)
+	}
+	ref.Count = 2
+	if !reflect.DeepEqual(v, ref) {
+		t.Fatalf("got %+v, want %+v", v, ref)
+	}
+	want := `00000000  53 54 52 43                                      Magic = [83 84 82 67]
+00000004  b1                                               A = 5 (bits 7-5)
+                                                           B = 17 (bits 4-0)
+00000005  00 01                                            Origin.X = 1
+00000007  ff ff                                            Origin.Y = -1
+00000009  02 00                                            Count = 2
+0000000b  00 02                                            Points[0].X = 2
+0000000d  00 03                                            Points[0].Y = 3
+0000000f  00 04                                            Points[1].X = 4
+00000011  00 05                                            Points[1].Y = 5
+00000013  01 02 03 04                                      Tail = 16909060
+00000017  6e 61 6d 65 6e 61 6d 65                          Name = "namename"
+`
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestDumpError(t *testing.T) {
+	ref := &layoutExample{Points: []layoutPoint{{2, 3}, {4, 5}}}
+	packed, err := AppendPack(nil, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = Dump(&out, bytes.NewReader(packed[:16]), &layoutExample{}, nil)
+	if err == nil || !strings.Contains(err.Error(), io.ErrUnexpectedEOF.Error()) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	want := `00000009  02 00                                            Count = 2
+0000000b  00 02                                            Points[0].X = 2
+0000000d  00 03                                            Points[0].Y = 3
+0000000f  00
+00000010  error: ` + err.Error() + "\n"
+	if !strings.HasSuffix(out.String(), want) {
+		t.Fatalf("got:\n%s\nwant suffix:\n%s", out.String(), want)
+	}
+}
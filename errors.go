@@ -0,0 +1,68 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// FieldError records an error and the struct field it occurred in.
+// Errors returned by Pack, Unpack, Sizeof and struct parsing are wrapped in
+// a *FieldError whenever they can be attributed to a field.
+type FieldError struct {
+	Type   reflect.Type // the outermost struct type, nil for a Format
+	Path   string       // field path from Type, e.g. "Header.Sections[3].Name"
+	Offset int64        // byte offset of the field, or -1 if not known
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	path := e.Path
+	if e.Type != nil {
+		path = fmt.Sprintf("%v.%s", e.Type, e.Path)
+	}
+	if e.Offset >= 0 {
+		return fmt.Sprintf("struc: %s (offset %d): %v", path, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("struc: %s: %v", path, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError attributes err to the field name of struct type t at offset. If
+// err already came from a nested struct, name is prepended to its path
+// instead, and offset is added to its offset when relative is set.
+func fieldError(err error, t reflect.Type, name string, offset int64, relative bool) error {
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return &FieldError{Type: t, Path: name, Offset: offset, Err: err}
+	}
+	if strings.HasPrefix(fe.Path, "[") {
+		fe.Path = name + fe.Path
+	} else {
+		fe.Path = name + "." + fe.Path
+	}
+	fe.Type = t
+	if relative && fe.Offset >= 0 {
+		fe.Offset += offset
+	}
+	return fe
+}
+
+// eofError cleans up an Unpack error caused by the end of the input: if
+// nothing was consumed the caller gets a bare io.EOF, as io.ReadFull would
+// report, otherwise the input was truncated.
+func eofError(err error, consumed bool) error {
+	fe, ok := err.(*FieldError)
+	if !ok || fe.Err != io.EOF {
+		return err
+	}
+	if !consumed {
+		return io.EOF
+	}
+	fe.Err = io.ErrUnexpectedEOF
+	return fe
+}
@@ -0,0 +1,169 @@
+package struc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type errSection struct {
+	A    uint8
+	Name string `struc:"cstring"`
+}
+
+type errHeader struct {
+	Count    int `struc:"uint8,sizeof=Sections"`
+	Sections []errSection
+}
+
+type errFile struct {
+	Magic  uint16
+	Header errHeader
+}
+
+func TestFieldErrorUnpack(t *testing.T) {
+	in := []byte{0, 1, 2, 1, 'a', 'b', 0, 2, 'c'}
+	err := Unpack(bytes.NewReader(in), &errFile{})
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected *FieldError, got %#v", err)
+	}
+	if fe.Type != reflect.TypeOf(errFile{}) || fe.Path != "Header.Sections[1].Name" || fe.Offset != 8 {
+		t.Fatalf("bad error location: %v", fe)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", fe.Err)
+	}
+}
+
+func TestFieldErrorPack(t *testing.T) {
+	v := &errFile{Header: errHeader{Sections: []errSection{{1, "ab"}, {2, "c\x00"}}}}
+	var buf bytes.Buffer
+	err := Pack(&buf, v)
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected *FieldError, got %#v", err)
+	}
+	if fe.Type != reflect.TypeOf(errFile{}) || fe.Path != "Header.Sections[1].Name" || fe.Offset != 8 {
+		t.Fatalf("bad error location: %v", fe)
+	}
+}
+
+type errNestedParse struct {
+	A     int
+	Inner missingSize
+}
+
+func TestFieldErrorParse(t *testing.T) {
+	err := parseTest(&errNestedParse{})
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected *FieldError, got %#v", err)
+	}
+	if fe.Type != reflect.TypeOf(errNestedParse{}) || fe.Path != "Inner.Test" || fe.Offset != -1 {
+		t.Fatalf("bad error location: %v", fe)
+	}
+}
+
+func TestUnpackEOF(t *testing.T) {
+	// a clean end of input is reported as a bare io.EOF
+	if err := Unpack(bytes.NewReader(nil), &errFile{}); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	err := Unpack(bytes.NewReader([]byte{0, 1}), &errFile{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+type badStringPtr struct {
+	S *string
+}
+
+type badPtrPtr struct {
+	P **int
+}
+
+type badSizeofTarget struct {
+	N int `struc:"uint8,sizeof=M"`
+	M int
+}
+
+type badSizefromSource struct {
+	N bool
+	B []byte `struc:"sizefrom=N"`
+}
+
+type badScalarLen struct {
+	A int `struc:"[4]int32"`
+}
+
+type badArrayLen struct {
+	A [2]byte `struc:"[4]byte"`
+}
+
+func TestParseErrors(t *testing.T) {
+	bad := []interface{}{
+		&badStringPtr{}, &badPtrPtr{}, &badSizeofTarget{},
+		&badSizefromSource{}, &badArrayLen{}, &badScalarLen{},
+	}
+	for _, v := range bad {
+		if _, err := Sizeof(v); err == nil {
+			t.Errorf("failed to reject %T", v)
+		}
+	}
+}
+
+type nilNested struct {
+	A     uint8
+	Inner *errSection
+}
+
+type signedLen struct {
+	N    int8 `struc:"int8,sizeof=Data"`
+	Data []byte
+}
+
+type arrayLen struct {
+	N   uint8
+	Arr [2]uint16 `struc:"[2]uint16,sizefrom=N"`
+}
+
+type shortLen struct {
+	N    int     `struc:"int8"`
+	Data []int32 `struc:"sizefrom=N"`
+}
+
+func TestBadValues(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &nilNested{}); err == nil {
+		t.Error("failed to error on nil pointer")
+	}
+	if err := Pack(&buf, &shortLen{N: 3, Data: []int32{1}}); !errors.Is(err, io.ErrShortBuffer) {
+		t.Errorf("expected io.ErrShortBuffer, got %v", err)
+	}
+	if err := Unpack(bytes.NewReader([]byte{1, 2}), errSection{}); err == nil {
+		t.Error("failed to error on unpack into a non-pointer")
+	}
+	if err := Unpack(bytes.NewReader([]byte{0xff}), &signedLen{}); err == nil {
+		t.Error("failed to error on negative length")
+	}
+	if err := Unpack(bytes.NewReader([]byte{3, 0, 0, 0, 0, 0, 0}), &arrayLen{}); err == nil {
+		t.Error("failed to error on length exceeding array")
+	}
+	if _, err := (Fields{&Field{Name: "S", Type: SizeType, Len: 1}}).Pack(make([]byte, 8), reflect.ValueOf(&struct{ S int }{}), &Options{}); err == nil {
+		t.Error("failed to error on invalid PtrSize")
+	}
+}
+
+func TestPackByValue(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, Int3Struct{I: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0, 0, 3}) {
+		t.Fatalf("got %v", buf.Bytes())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
 )
@@ -22,6 +23,25 @@ type Field struct {
 	Sizefrom []int
 	Fields   Fields
 	kind     reflect.Kind
+
+	bits     int // bitfield width, 0 if not a bitfield
+	bitUnit  int
+	bitStart int
+	bitGroup *bitGroup
+	lsb      bool
+	cond     *condition
+
+	switchFrom []int        // union field: index of its discriminator
+	unionType  reflect.Type // union field: its interface type
+	switchFor  []int        // discriminator: index of its union field
+
+	alignment int // align= tag, 0 if unset
+	offset    int // offset= tag, -1 if unset
+
+	magic    []byte        // magic= tag
+	constant reflect.Value // const= tag, of the field's Go type
+	checksum *checksum     // checksum= tag
+	byteLen  bool          // bytesizeof= or bytesizefrom=: the length is in bytes
 }
 
 func (f *Field) String() string {
@@ -31,6 +51,9 @@ func (f *Field) String() string {
 	} else {
 		out = fmt.Sprintf("type: %s, order: %v", f.Type.String(), f.Order)
 	}
+	if f.bits > 0 {
+		out += fmt.Sprintf(", bits: %d", f.bits)
+	}
 	if f.Sizefrom != nil {
 		out += fmt.Sprintf(", sizefrom: %v", f.Sizefrom)
 	} else if f.Len > 0 {
@@ -42,10 +65,27 @@ func (f *Field) String() string {
 	return "{" + out + "}"
 }
 
-func (f *Field) Size(val reflect.Value, options *Options) int {
+func (f *Field) Size(val reflect.Value, options *Options) (int, error) {
+	return f.size(val, options, 0)
+}
+
+// size is Size for a field of a struct nested depth deep.
+func (f *Field) size(val reflect.Value, options *Options, depth int) (int, error) {
 	typ := f.Type.Resolve(options)
 	size := 0
-	if typ == Struct {
+	if f.hasMagic() {
+		magic, err := f.magicBytes(options)
+		if err != nil {
+			return 0, err
+		}
+		size = len(magic)
+	} else if f.bitGroup != nil {
+		// the first bitfield in a group accounts for the shared storage
+		if f.bitGroup.fields[0] != f {
+			return 0, nil
+		}
+		size = f.bitGroup.size
+	} else if typ == Struct {
 		vals := []reflect.Value{val}
 		if f.Slice {
 			vals = make([]reflect.Value, val.Len())
@@ -53,13 +93,56 @@ func (f *Field) Size(val reflect.Value, options *Options) int {
 				vals[i] = val.Index(i)
 			}
 		}
-		for _, val := range vals {
-			size += f.Fields.Sizeof(val, options)
+		for i, v := range vals {
+			n, err := f.Fields.sizeof(v, options, depth)
+			if err != nil {
+				if f.Slice {
+					err = fieldError(err, val.Type(), fmt.Sprintf("[%d]", i), -1, false)
+				}
+				return 0, err
+			}
+			size += n
 		}
 	} else if typ == Pad {
 		size = f.Len
+	} else if typ == UnionType {
+		v, fields, err := unionValue(val)
+		if err != nil {
+			return 0, err
+		}
+		if size, err = fields.sizeof(v, options, depth); err != nil {
+			return 0, err
+		}
+	} else if typ.variable() {
+		if f.Slice {
+			length := val.Len()
+			if f.Len > 0 {
+				length = f.Len
+			}
+			for i := 0; i < length; i++ {
+				if i < val.Len() {
+					size += varintSize(typ, val.Index(i))
+				} else {
+					// zero padding
+					size += 1
+				}
+			}
+		} else {
+			if f.Ptr {
+				val = val.Elem()
+			}
+			size = varintSize(typ, val)
+		}
+	} else if typ == CString {
+		if f.Slice {
+			size = f.Len
+		} else {
+			size = val.Len() + 1
+		}
 	} else if typ == CustomType {
-		return val.Addr().Interface().(Custom).Size(options)
+		return val.Addr().Interface().(Custom).Size(options), nil
+	} else if typ.Size() == 0 {
+		return 0, fmt.Errorf("cannot size field of type %s", typ)
 	} else if f.Slice || f.kind == reflect.String {
 		length := val.Len()
 		if f.Len > 1 {
@@ -73,23 +156,29 @@ func (f *Field) Size(val reflect.Value, options *Options) int {
 	if align > 0 && size < align {
 		size = align
 	}
-	return size
+	return size, nil
 }
 
-func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Options) (size int, err error) {
+func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Options, depth int) (size int, err error) {
 	order := f.Order
 	if options.Order != nil {
 		order = options.Order
 	}
 	if f.Ptr {
+		if val.IsNil() {
+			return 0, fmt.Errorf("cannot pack nil pointer")
+		}
 		val = val.Elem()
 	}
 	typ := f.Type.Resolve(options)
 	switch typ {
 	case Struct:
-		return f.Fields.Pack(buf, val, options)
+		return f.Fields.pack(buf, val, options, depth)
 	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
 		size = typ.Size()
+		if len(buf) < size {
+			return 0, io.ErrShortBuffer
+		}
 		var n uint64
 		switch f.kind {
 		case reflect.Bool:
@@ -121,6 +210,9 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 		}
 	case Float32, Float64:
 		size = typ.Size()
+		if len(buf) < size {
+			return 0, io.ErrShortBuffer
+		}
 		n := val.Float()
 		switch typ {
 		case Float32:
@@ -129,6 +221,9 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 			order.PutUint64(buf, math.Float64bits(n))
 		}
 	case String:
+		if len(buf) < val.Len() {
+			return 0, io.ErrShortBuffer
+		}
 		switch f.kind {
 		case reflect.String:
 			size = val.Len()
@@ -138,17 +233,38 @@ func (f *Field) packVal(buf []byte, val reflect.Value, length int, options *Opti
 			size = val.Len()
 			copy(buf, val.Bytes())
 		}
+	case Uvarint, Varint, Sleb128:
+		if len(buf) < varintSize(typ, val) {
+			return 0, io.ErrShortBuffer
+		}
+		return packVarint(buf, typ, val), nil
 	case CustomType:
 		return val.Addr().Interface().(Custom).Pack(buf, options)
+	case UnionType:
+		v, fields, err := unionValue(val)
+		if err != nil {
+			return 0, err
+		}
+		return fields.pack(buf, v, options, depth)
 	default:
-		panic(fmt.Sprintf("no pack handler for type: %s", typ))
+		return 0, fmt.Errorf("no pack handler for type: %s", typ)
 	}
 	return
 }
 
 func (f *Field) Pack(buf []byte, val reflect.Value, length int, options *Options) (int, error) {
+	return f.pack(buf, val, length, options, 0)
+}
+
+// pack is Pack for a field of a struct nested depth deep.
+func (f *Field) pack(buf []byte, val reflect.Value, length int, options *Options, depth int) (int, error) {
 	typ := f.Type.Resolve(options)
-	if typ == Pad {
+	if typ == CString {
+		return f.packCString(buf, val)
+	} else if typ == Pad {
+		if len(buf) < length {
+			return 0, io.ErrShortBuffer
+		}
 		for i := 0; i < length; i++ {
 			buf[i] = 0
 		}
@@ -164,6 +280,9 @@ func (f *Field) Pack(buf []byte, val reflect.Value, length int, options *Options
 			} else {
 				tmp = val.Bytes()
 			}
+			if len(buf) < end || len(buf) < length {
+				return 0, io.ErrShortBuffer
+			}
 			copy(buf, tmp)
 			if end < length {
 				// TODO: allow configuring pad byte?
@@ -176,22 +295,23 @@ func (f *Field) Pack(buf []byte, val reflect.Value, length int, options *Options
 		pos := 0
 		var zero reflect.Value
 		if end < length {
-			zero = reflect.Zero(val.Type().Elem())
+			// addressable, so Custom elements can be packed too
+			zero = reflect.New(val.Type().Elem()).Elem()
 		}
 		for i := 0; i < length; i++ {
 			cur := zero
 			if i < end {
 				cur = val.Index(i)
 			}
-			if n, err := f.packVal(buf[pos:], cur, 1, options); err != nil {
-				return pos, err
+			if n, err := f.packVal(buf[pos:], cur, 1, options, depth); err != nil {
+				return pos, fieldError(err, val.Type(), fmt.Sprintf("[%d]", i), int64(pos), true)
 			} else {
 				pos += n
 			}
 		}
 		return pos, nil
 	} else {
-		return f.packVal(buf, val, length, options)
+		return f.packVal(buf, val, length, options, depth)
 	}
 }
 
@@ -217,7 +337,7 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 		case reflect.Float32, reflect.Float64:
 			val.SetFloat(n)
 		default:
-			return fmt.Errorf("struc: refusing to unpack float into field %s of type %s", f.Name, f.kind.String())
+			return fmt.Errorf("refusing to unpack float into field %s of type %s", f.Name, f.kind.String())
 		}
 	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
 		var n uint64
@@ -248,14 +368,17 @@ func (f *Field) unpackVal(buf []byte, val reflect.Value, length int, options *Op
 			val.SetUint(n)
 		}
 	default:
-		panic(fmt.Sprintf("no unpack handler for type: %s", typ))
+		return fmt.Errorf("no unpack handler for type: %s", typ)
 	}
 	return nil
 }
 
 func (f *Field) Unpack(buf []byte, val reflect.Value, length int, options *Options) error {
 	typ := f.Type.Resolve(options)
-	if typ == Pad || f.kind == reflect.String {
+	if typ == CString {
+		f.unpackCString(buf, val)
+		return nil
+	} else if typ == Pad || f.kind == reflect.String {
 		if typ == Pad {
 			return nil
 		} else {
@@ -263,6 +386,9 @@ func (f *Field) Unpack(buf []byte, val reflect.Value, length int, options *Optio
 			return nil
 		}
 	} else if f.Slice {
+		if f.Array && length > val.Len() {
+			return fmt.Errorf("length %d exceeds array length %d", length, val.Len())
+		}
 		if val.Cap() < length {
 			val.Set(reflect.MakeSlice(val.Type(), length, length))
 		} else if val.Len() < length {
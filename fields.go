@@ -28,150 +28,501 @@ func (f Fields) String() string {
 	return "{" + strings.Join(fields, ", ") + "}"
 }
 
-func (f Fields) Sizeof(val reflect.Value, options *Options) int {
-	for val.Kind() == reflect.Ptr {
-		val = val.Elem()
+func (f Fields) Sizeof(val reflect.Value, options *Options) (int, error) {
+	return f.sizeof(val, options, 0)
+}
+
+// enter counts a struct being sized or packed inside depth others against
+// options.maxDepth(), as the reader does for Unpack, so a cyclic value fails
+// instead of exhausting the stack.
+func enter(depth int, options *Options) (int, error) {
+	depth++
+	if max := options.maxDepth(); depth > max {
+		return depth, &LimitError{Limit: "MaxDepth", Max: max, Value: int64(depth)}
+	}
+	return depth, nil
+}
+
+func (f Fields) sizeof(val reflect.Value, options *Options, depth int) (int, error) {
+	depth, err := enter(depth, options)
+	if err != nil {
+		return 0, err
+	}
+	val, err = structValue(val)
+	if err != nil {
+		return 0, err
 	}
 	size := 0
 	for i, field := range f {
 		if field != nil {
-			size += field.Size(val.Field(i), options)
+			if field.cond != nil && !field.cond.eval(val) {
+				continue
+			}
+			v := val.Field(i)
+			if field.Sizeof != nil && field.Type.variable() {
+				// the encoded size depends on the length being stored
+				if v, err = f.packValue(val, field, v, options, depth); err != nil {
+					return 0, fieldError(err, val.Type(), field.Name, -1, false)
+				}
+			}
+			n, err := field.size(v, options, depth)
+			if err != nil {
+				return 0, fieldError(err, val.Type(), field.Name, -1, false)
+			}
+			pad, err := field.padding(size, options)
+			if err != nil {
+				return 0, fieldError(err, val.Type(), field.Name, -1, false)
+			}
+			size += pad + n
 		}
 	}
-	return size
+	return size + f.padding(size, options), nil
 }
 
-func (f Fields) sizefrom(val reflect.Value, index []int) int {
+// structValue dereferences val down to the struct it points to.
+func structValue(val reflect.Value) (reflect.Value, error) {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return val, fmt.Errorf("nil pointer to %v", val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return val, fmt.Errorf("%v is not a struct", val.Type())
+	}
+	return val, nil
+}
+
+func (f Fields) sizefrom(val reflect.Value, index []int) (int, error) {
 	field := val.FieldByIndex(index)
+	var n int
 	switch field.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return int(field.Int())
+		n = int(field.Int())
+		if int64(n) != field.Int() {
+			n = -1
+		}
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		n := int(field.Uint())
+		n = int(field.Uint())
 		// all the builtin array length types are native int
 		// so this guards against weird truncation
-		if n < 0 {
-			return 0
+		if n < 0 || uint64(n) != field.Uint() {
+			n = -1
 		}
-		return n
 	default:
 		name := val.Type().FieldByIndex(index).Name
-		panic(fmt.Sprintf("sizeof field %T.%s not an integer type", val.Interface(), name))
+		return 0, fmt.Errorf("sizeof field `%s` is not an integer", name)
+	}
+	if n < 0 {
+		name := val.Type().FieldByIndex(index).Name
+		return 0, fmt.Errorf("sizeof field `%s` holds invalid length %v", name, field.Interface())
+	}
+	return n, nil
+}
+
+// skipped reports whether the field at index is left out by its if= tag.
+func (f Fields) skipped(val reflect.Value, index []int) bool {
+	target := f[index[0]]
+	return target != nil && target.cond != nil && !target.cond.eval(val)
+}
+
+// packValue returns the value to pack for a field, substituting the values
+// Pack fills in automatically (sizeof lengths and union discriminators).
+func (f Fields) packValue(val reflect.Value, field *Field, v reflect.Value, options *Options, depth int) (reflect.Value, error) {
+	if field.Sizeof != nil {
+		target := val.FieldByIndex(field.Sizeof)
+		length := target.Len()
+		if f.skipped(val, field.Sizeof) {
+			// the target is skipped, so nothing follows for the length to count
+			length = 0
+		} else if field.byteLen {
+			tf := f[field.Sizeof[0]]
+			if tf == nil {
+				return v, fmt.Errorf("bytesizeof field is not packed")
+			}
+			var err error
+			if length, err = tf.size(target, options, depth); err != nil {
+				return v, err
+			}
+		}
+		switch field.kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// allocating a new int here has fewer side effects (doesn't update the original struct)
+			// but it's a wasteful allocation
+			// the old method might work if we just cast the temporary int/uint to the target type
+			v = reflect.New(v.Type()).Elem()
+			v.SetInt(int64(length))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v = reflect.New(v.Type()).Elem()
+			v.SetUint(uint64(length))
+		default:
+			return v, fmt.Errorf("sizeof field is not an integer: %s", v.Type())
+		}
+	}
+	if field.switchFor != nil && !f.skipped(val, field.switchFor) {
+		// a skipped union keeps the discriminator's own value
+		key, err := unionKey(val.FieldByIndex(field.switchFor))
+		if err != nil {
+			return v, err
+		}
+		v = reflect.New(v.Type()).Elem()
+		switch field.kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(key)
+		default:
+			v.SetUint(uint64(key))
+		}
 	}
+	return v, nil
 }
 
 func (f Fields) Pack(buf []byte, val reflect.Value, options *Options) (int, error) {
-	for val.Kind() == reflect.Ptr {
-		val = val.Elem()
+	return f.pack(buf, val, options, 0)
+}
+
+func (f Fields) pack(buf []byte, val reflect.Value, options *Options, depth int) (int, error) {
+	depth, err := enter(depth, options)
+	if err != nil {
+		return 0, err
+	}
+	val, err = structValue(val)
+	if err != nil {
+		return 0, err
+	}
+	var spans *checksumSpans
+	if f.hasChecksum() {
+		spans = newChecksumSpans(len(f))
 	}
 	pos := 0
 	for i, field := range f {
-		if field == nil {
+		if field == nil || field.cond != nil && !field.cond.eval(val) {
+			spans.set(i, pos, pos)
 			continue
 		}
-		v := val.Field(i)
-		length := field.Len
-		if field.Sizefrom != nil {
-			length = f.sizefrom(val, field.Sizefrom)
-		}
-		if length <= 0 && field.Slice {
-			length = v.Len()
-		}
-		if field.Sizeof != nil {
-			length := val.FieldByIndex(field.Sizeof).Len()
-			switch field.kind {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				// allocating a new int here has fewer side effects (doesn't update the original struct)
-				// but it's a wasteful allocation
-				// the old method might work if we just cast the temporary int/uint to the target type
-				v = reflect.New(v.Type()).Elem()
-				v.SetInt(int64(length))
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				v = reflect.New(v.Type()).Elem()
-				v.SetUint(uint64(length))
-			default:
-				panic(fmt.Sprintf("sizeof field is not int or uint type: %s, %s", field.Name, v.Type()))
-			}
-		}
-		if n, err := field.Pack(buf[pos:], v, length, options); err != nil {
-			return n, err
-		} else {
-			pos += n
+		pad, err := field.padding(pos, options)
+		if err == nil {
+			pos, err = zeroPad(buf, pos, pad)
+		}
+		if err != nil {
+			return pos, fieldError(err, val.Type(), field.Name, int64(pos), true)
+		}
+		n, err := f.packField(buf[pos:], val, i, field, options, depth)
+		if err != nil {
+			return pos, fieldError(err, val.Type(), field.Name, int64(pos), true)
+		}
+		spans.set(i, pos, pos+n)
+		pos += n
+	}
+	if spans != nil {
+		f.writeChecksums(buf, spans, options)
+	}
+	return zeroPad(buf, pos, f.padding(pos, options))
+}
+
+// padding returns the bytes inserted before a field at offset pos of its
+// struct, for the offset= and align= tags and Options.CABI. Bitfields after
+// the first of a group share its storage.
+func (f *Field) padding(pos int, options *Options) (int, error) {
+	if f.bitGroup != nil && f.bitGroup.fields[0] != f {
+		return 0, nil
+	}
+	if f.offset >= 0 {
+		if pos > f.offset {
+			return 0, fmt.Errorf("field is at offset %d, past offset=%d", pos, f.offset)
+		}
+		return f.offset - pos, nil
+	}
+	align := f.alignment
+	if options.CABI != ABINone {
+		align = f.align(options)
+	}
+	return alignUp(pos, align) - pos, nil
+}
+
+// padding returns the bytes Options.CABI appends to a struct of size bytes.
+func (f Fields) padding(size int, options *Options) int {
+	if options.CABI == ABINone {
+		return 0
+	}
+	return alignUp(size, f.align(options)) - size
+}
+
+// zeroPad writes n zero bytes at buf[pos:] for alignment.
+func zeroPad(buf []byte, pos, n int) (int, error) {
+	if n == 0 {
+		return pos, nil
+	}
+	if len(buf) < pos+n {
+		return pos, io.ErrShortBuffer
+	}
+	for i := pos; i < pos+n; i++ {
+		buf[i] = 0
+	}
+	return pos + n, nil
+}
+
+func (f Fields) packField(buf []byte, val reflect.Value, i int, field *Field, options *Options, depth int) (int, error) {
+	if field.cond != nil && !field.cond.eval(val) {
+		return 0, nil
+	}
+	if field.bitGroup != nil {
+		if field.bitGroup.fields[0] == field {
+			return field.bitGroup.Pack(buf, val, options)
+		}
+		return 0, nil
+	}
+	if field.hasMagic() {
+		return field.packMagic(buf, options)
+	}
+	v := val.Field(i)
+	length := field.Len
+	if field.Sizefrom != nil {
+		var err error
+		if length, err = f.sizefrom(val, field.Sizefrom); err != nil {
+			return 0, err
 		}
+		if field.byteLen {
+			if length, err = field.byteCount(length, v, options); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if length <= 0 && field.Slice {
+		length = v.Len()
 	}
-	return pos, nil
+	v, err := f.packValue(val, field, v, options, depth)
+	if err != nil {
+		return 0, err
+	}
+	return field.pack(buf, v, length, options, depth)
 }
 
 func (f Fields) Unpack(r io.Reader, val reflect.Value, options *Options) error {
-	for val.Kind() == reflect.Ptr {
-		val = val.Elem()
+	val, err := structValue(val)
+	if err != nil {
+		return err
+	}
+	if !val.CanSet() {
+		return fmt.Errorf("cannot unpack into unaddressable %v, pass a pointer", val.Type())
+	}
+	rd, ok := r.(*reader)
+	if !ok {
+		rd = &reader{r: r}
+		rd.limit(options)
+	}
+	rd.depth++
+	defer func() { rd.depth-- }()
+	if max := options.maxDepth(); rd.depth > max {
+		return &LimitError{Limit: "MaxDepth", Max: max, Value: int64(rd.depth)}
+	}
+	base := rd.off
+	var spans *checksumSpans
+	rec := len(rd.rec)
+	if f.hasChecksum() {
+		// keep the raw bytes to verify checksums against
+		spans = newChecksumSpans(len(f))
+		rd.recording++
+		defer func() {
+			if rd.recording--; rd.recording == 0 {
+				rd.rec = rd.rec[:0]
+			}
+		}()
 	}
-	var tmp [8]byte
-	var buf []byte
 	for i, field := range f {
 		if field == nil {
+			spans.set(i, int(rd.off-base), int(rd.off-base))
 			continue
 		}
+		if field.cond == nil || field.cond.eval(val) {
+			pad, err := field.padding(int(rd.off-base), options)
+			if err == nil {
+				err = rd.skip(pad)
+			}
+			if err != nil {
+				return fieldError(err, val.Type(), field.Name, rd.off, false)
+			}
+		}
+		start := rd.off
+		if err := f.unpackField(rd, val, i, field, options); err != nil {
+			return fieldError(err, val.Type(), field.Name, start, false)
+		}
+		spans.set(i, int(start-base), int(rd.off-base))
+	}
+	if err := rd.skip(f.padding(int(rd.off-base), options)); err != nil {
+		return err
+	}
+	if spans != nil {
+		return f.verifyChecksums(val.Type(), rd.rec[rec:], base, spans, options)
+	}
+	return nil
+}
+
+func (f Fields) unpackField(r *reader, val reflect.Value, i int, field *Field, options *Options) error {
+	if field.cond != nil && !field.cond.eval(val) {
+		// leave no stale data behind when reusing a struct
 		v := val.Field(i)
-		length := field.Len
-		if field.Sizefrom != nil {
-			length = f.sizefrom(val, field.Sizefrom)
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if field.bitGroup != nil {
+		if group := field.bitGroup; group.fields[0] == field {
+			buf, err := r.next(group.size, nil)
+			if err != nil {
+				return err
+			}
+			return group.Unpack(buf, val, options)
 		}
-		if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
-			v.Set(reflect.New(v.Type().Elem()))
+		return nil
+	}
+	if field.hasMagic() {
+		return field.unpackMagic(r, val.Field(i), options)
+	}
+	v := val.Field(i)
+	length := field.Len
+	if field.Sizefrom != nil {
+		var err error
+		if length, err = f.sizefrom(val, field.Sizefrom); err != nil {
+			return err
 		}
-		if field.Type == Struct {
-			if field.Slice {
-				vals := v
+		if err := checkSliceLen(length, options); err != nil {
+			return err
+		}
+		if field.byteLen {
+			if field.Type == Struct || field.Type.Resolve(options).variable() {
+				return f.unpackByteLen(r, v, field, length, options)
+			}
+			if length, err = field.byteCount(length, v, options); err != nil {
+				return err
+			}
+		}
+	}
+	if v.Kind() == reflect.Ptr && !v.Elem().IsValid() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	switch field.Type {
+	case Struct:
+		if field.Slice {
+			vals := v
+			if !field.Array {
+				vals = makeSlice(v.Type(), v, length)
+			} else if length > v.Len() {
+				return fmt.Errorf("length %d exceeds array length %d", length, v.Len())
+			}
+			for i := 0; i < length; i++ {
 				if !field.Array {
-					vals = reflect.MakeSlice(v.Type(), length, length)
+					vals = growSlice(vals, i)
 				}
-				for i := 0; i < length; i++ {
-					v := vals.Index(i)
-					fields, err := parseFields(v)
-					if err != nil {
-						return err
-					}
-					if err := fields.Unpack(r, v, options); err != nil {
-						return err
+				start := r.off
+				if err := unpackStruct(r, vals.Index(i), options); err != nil {
+					if !field.Array {
+						// keep the elements decoded so far, for Dump
+						v.Set(vals.Slice(0, i))
 					}
-				}
-				if !field.Array {
-					v.Set(vals)
-				}
-			} else {
-				// TODO: DRY (we repeat the inner loop above)
-				fields, err := parseFields(v)
-				if err != nil {
-					return err
-				}
-				if err := fields.Unpack(r, v, options); err != nil {
-					return err
+					return fieldError(err, v.Type(), fmt.Sprintf("[%d]", i), start, false)
 				}
 			}
-			continue
+			if !field.Array {
+				v.Set(vals)
+			}
+			return nil
+		}
+		return unpackStruct(r, v, options)
+	case UnionType:
+		return unpackUnion(r, v, val.FieldByIndex(field.switchFrom), options)
+	}
+	typ := field.Type.Resolve(options)
+	switch {
+	case typ == CustomType:
+		return v.Addr().Interface().(Custom).Unpack(r, length, options)
+	case typ.variable():
+		return field.unpackVarint(r, v, length, options)
+	case typ == CString && !field.Slice:
+		buf, err := readCString(r, options.MaxSliceLen)
+		if err != nil {
+			return err
+		}
+		field.unpackCString(buf, v)
+		return nil
+	default:
+		if typ.Size() > 0 && length > maxInt/typ.Size() {
+			return fmt.Errorf("length %d is too large", length)
+		}
+		size := length * typ.Size()
+		buf, err := r.next(size, nil)
+		if err != nil {
+			return err
+		}
+		return field.Unpack(buf, v, length, options)
+	}
+}
+
+// byteCount converts the byte length n of a bytesizefrom= field into an
+// element count. Elements of variable size are all packed.
+func (f *Field) byteCount(n int, v reflect.Value, options *Options) (int, error) {
+	typ := f.Type.Resolve(options)
+	if f.Type == Struct || typ.variable() {
+		return v.Len(), nil
+	}
+	size := typ.Size()
+	if n%size != 0 {
+		return 0, fmt.Errorf("byte length %d is not a multiple of the %d byte element size", n, size)
+	}
+	return n / size, nil
+}
+
+// unpackByteLen unpacks struct or varint elements from the next n bytes
+// until they are used up.
+func (f Fields) unpackByteLen(r *reader, v reflect.Value, field *Field, n int, options *Options) error {
+	start := r.off
+	data, err := r.next(n, nil)
+	if err != nil {
+		return err
+	}
+	sub := &reader{buf: data, off: start, depth: r.depth}
+	typ := field.Type.Resolve(options)
+	vals := v
+	if !field.Array {
+		vals = makeSlice(v.Type(), v, 0)
+	}
+	for i := 0; len(sub.buf) > 0; i++ {
+		if field.Array && i >= v.Len() {
+			return fmt.Errorf("byte length %d holds more than %d elements", n, v.Len())
+		}
+		if !field.Array {
+			vals = growSlice(vals, i)
+		}
+		elem := sub.off
+		if field.Type == Struct {
+			err = unpackStruct(sub, vals.Index(i), options)
 		} else {
-			typ := field.Type.Resolve(options)
-			if typ == CustomType {
-				if err := v.Addr().Interface().(Custom).Unpack(r, length, options); err != nil {
-					return err
-				}
-			} else {
-				size := length * field.Type.Resolve(options).Size()
-				if size < 8 {
-					buf = tmp[:size]
-				} else {
-					buf = make([]byte, size)
-				}
-				if _, err := io.ReadFull(r, buf); err != nil {
-					return err
-				}
-				err := field.Unpack(buf[:size], v, length, options)
-				if err != nil {
-					return err
-				}
+			var x uint64
+			if x, err = readVarint(sub, typ); err == nil {
+				setVarint(vals.Index(i), x)
+			}
+		}
+		if err != nil {
+			overrun := fmt.Errorf("element overruns byte length %d", n)
+			if fe, ok := err.(*FieldError); ok && (fe.Err == io.EOF || fe.Err == io.ErrUnexpectedEOF) {
+				fe.Err = overrun
+			} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = overrun
+			}
+			if !field.Array {
+				v.Set(vals.Slice(0, i))
 			}
+			return fieldError(err, v.Type(), fmt.Sprintf("[%d]", i), elem, false)
 		}
 	}
+	if !field.Array {
+		v.Set(vals)
+	}
 	return nil
 }
+
+func unpackStruct(r io.Reader, v reflect.Value, options *Options) error {
+	fields, err := parseFields(v)
+	if err != nil {
+		return err
+	}
+	return fields.Unpack(r, v, options)
+}
@@ -3,6 +3,7 @@ package struc
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -50,12 +51,9 @@ type sizefromStructBad struct {
 func TestFieldsSizefromBad(t *testing.T) {
 	var test = &sizefromStructBad{Var1: []byte{1, 2, 3}}
 	var buf bytes.Buffer
-	defer func() {
-		if err := recover(); err == nil {
-			t.Fatal("failed to panic on bad sizeof type")
-		}
-	}()
-	Pack(&buf, &test)
+	if err := Pack(&buf, &test); err == nil {
+		t.Fatal("failed to error on bad sizeof type")
+	}
 }
 
 type StructWithinArray struct {
@@ -79,3 +77,123 @@ func TestStrucArray(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type alignedStruct struct {
+	Len   int `struc:"uint8,sizeof=Name"`
+	Name  string
+	Value uint32 `struc:"align=4"`
+	Tail  uint16 `struc:"offset=16"`
+}
+
+func TestFieldsAlignOffset(t *testing.T) {
+	in := &alignedStruct{Len: 3, Name: "abc", Value: 0x01020304, Tail: 0x0506}
+	want := []byte{3, 'a', 'b', 'c', 1, 2, 3, 4, 0, 0, 0, 0, 0, 0, 0, 0, 5, 6}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buf.Bytes(), want)
+	}
+	out := &alignedStruct{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+	schema, err := Layout((*alignedStruct)(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// offset= fixes the position after the variable-length Name
+	if tail := schema.Fields[3]; tail.Offset != 16 || schema.Fields[2].Offset != Dynamic {
+		t.Fatalf("offsets %d, %d", schema.Fields[2].Offset, tail.Offset)
+	}
+}
+
+func TestFieldsOffsetPast(t *testing.T) {
+	in := &alignedStruct{Name: "abcdefghijkl"}
+	if _, err := Sizeof(in); err == nil {
+		t.Fatal("Sizeof didn't fail for a field past its offset")
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err == nil {
+		t.Fatal("Pack didn't fail for a field past its offset")
+	}
+	data := append([]byte{12}, make([]byte, 32)...)
+	if err := Unpack(bytes.NewReader(data), &alignedStruct{}); err == nil || !strings.Contains(err.Error(), "past offset=16") {
+		t.Fatalf("Unpack: %v", err)
+	}
+}
+
+func TestFieldsAlignBad(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			A int `struc:"int8,align=0"`
+		}{},
+		&struct {
+			A int `struc:"int8,align=x"`
+		}{},
+		&struct {
+			A int `struc:"int8,offset=-1"`
+		}{},
+	} {
+		if _, err := Sizeof(v); err == nil {
+			t.Errorf("%T: expected error", v)
+		}
+	}
+}
+
+type byteSizeEntry struct {
+	N    int `struc:"uint8,sizeof=Name"`
+	Name string
+}
+
+type byteSizeStruct struct {
+	Size    int `struc:"uint16,bytesizeof=Values"`
+	Values  []int32
+	Len     int `struc:"uint8,bytesizeof=Entries"`
+	Entries []byteSizeEntry
+	VLen    int   `struc:"uint8"`
+	Varints []int `struc:"[]uvarint,bytesizefrom=VLen"`
+	Tail    uint8
+}
+
+func TestFieldsByteSize(t *testing.T) {
+	in := &byteSizeStruct{
+		Values:  []int32{1, 2, 3},
+		Entries: []byteSizeEntry{{1, "a"}, {3, "bcd"}},
+		VLen:    3,
+		Varints: []int{1, 300},
+		Tail:    9,
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out := &byteSizeStruct{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	in.Size, in.Len = 12, 6
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestFieldsByteSizeBad(t *testing.T) {
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{[]byte{0, 3, 1, 2, 3, 0, 0, 0, 0}, "not a multiple of the 4 byte element size"},
+		{[]byte{0, 0, 3, 3, 'a', 'b', 0, 0, 0}, "Entries[0].Name (offset 4): element overruns byte length 3"},
+	}
+	for _, test := range tests {
+		_, err := UnpackBytes(test.data, &byteSizeStruct{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error containing %q, got %v", test.err, err)
+		}
+	}
+}
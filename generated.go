@@ -0,0 +1,77 @@
+package struc
+
+import (
+	"io"
+	"reflect"
+)
+
+// Generated is implemented by types with reflection-free methods written by
+// cmd/strucgen. Pack, Unpack and Sizeof call them instead of walking the
+// struct with reflection, unless Options.ByteAlign, Options.CABI or
+// Options.MaxDepth is set. The methods must produce the same bytes as the
+// reflective encoder. They don't enforce DefaultMaxDepth, which is why
+// cmd/strucgen refuses recursive types.
+type Generated interface {
+	StrucSize(opt *Options) (int, error)
+	StrucPack(buf []byte, opt *Options) (int, error)
+	StrucUnpack(r io.Reader, opt *Options) error
+}
+
+var generatedType = reflect.TypeOf((*Generated)(nil)).Elem()
+
+// generatedPacker uses a type's Generated methods, falling back to its
+// Fields when the options aren't supported by generated code.
+type generatedPacker struct {
+	Fields
+}
+
+func generated(val reflect.Value, options *Options) (Generated, bool) {
+	if options.ByteAlign != 0 || options.CABI != ABINone || options.MaxDepth != 0 || !val.CanAddr() {
+		return nil, false
+	}
+	return val.Addr().Interface().(Generated), true
+}
+
+func (p generatedPacker) Sizeof(val reflect.Value, options *Options) (int, error) {
+	if g, ok := generated(val, options); ok {
+		return g.StrucSize(options)
+	}
+	return p.Fields.Sizeof(val, options)
+}
+
+func (p generatedPacker) Pack(buf []byte, val reflect.Value, options *Options) (int, error) {
+	if g, ok := generated(val, options); ok {
+		return g.StrucPack(buf, options)
+	}
+	return p.Fields.Pack(buf, val, options)
+}
+
+func (p generatedPacker) Unpack(r io.Reader, val reflect.Value, options *Options) error {
+	g, ok := generated(val, options)
+	if !ok {
+		return p.Fields.Unpack(r, val, options)
+	}
+	rd, ok := r.(*reader)
+	if !ok {
+		rd = &reader{r: r}
+		rd.limit(options)
+	}
+	start := rd.off
+	err := g.StrucUnpack(rd, options)
+	if err == io.EOF && rd.off != start {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadN reads exactly n bytes from r, using tmp as storage if it is large
+// enough. It is used by generated code: when r comes from Unpack it enforces
+// Options.MaxTotalBytes and avoids copying, and large reads only allocate as
+// data arrives. The result is only valid until the next read from r.
+func ReadN(r io.Reader, n int, tmp []byte) ([]byte, error) {
+	rd, ok := r.(*reader)
+	if !ok {
+		rd = &reader{r: r}
+	}
+	return rd.next(n, tmp)
+}
@@ -0,0 +1,79 @@
+package struc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type genExample struct {
+	A uint16
+	B uint8
+}
+
+// The generated methods pack in a different order from the struct, so tests
+// can tell which path was taken.
+func (g *genExample) StrucSize(opt *Options) (int, error) {
+	return 3, nil
+}
+
+func (g *genExample) StrucPack(buf []byte, opt *Options) (int, error) {
+	buf[0] = g.B
+	buf[1] = byte(g.A >> 8)
+	buf[2] = byte(g.A)
+	return 3, nil
+}
+
+func (g *genExample) StrucUnpack(r io.Reader, opt *Options) error {
+	b, err := ReadN(r, 3, nil)
+	if err != nil {
+		return err
+	}
+	g.B = b[0]
+	g.A = uint16(b[1])<<8 | uint16(b[2])
+	return nil
+}
+
+func TestGeneratedPreferred(t *testing.T) {
+	ref := &genExample{A: 0x0102, B: 3}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{3, 1, 2}) {
+		t.Fatalf("generated Pack not used: %v", buf.Bytes())
+	}
+	out := &genExample{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if *out != *ref {
+		t.Fatalf("got %+v, want %+v", out, ref)
+	}
+	if err := Unpack(bytes.NewReader([]byte{3}), out); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := Unpack(bytes.NewReader(nil), out); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestGeneratedFallback(t *testing.T) {
+	ref := genExample{A: 0x0102, B: 3}
+	// Packing by value can't call pointer methods on the caller's struct,
+	// so the copy is packed instead.
+	b, err := AppendPack(nil, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{3, 1, 2}) {
+		t.Fatalf("generated Pack not used: %v", b)
+	}
+	var buf bytes.Buffer
+	if err := PackWithOptions(&buf, &ref, &Options{MaxDepth: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{1, 2, 3}) {
+		t.Fatalf("reflective Pack not used: %v", buf.Bytes())
+	}
+}
@@ -0,0 +1,388 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// Dynamic is reported for offsets, sizes and lengths that depend on the
+// value being packed.
+const Dynamic = -1
+
+// A Schema describes the packed layout of a struct type, as returned by
+// Layout.
+type Schema struct {
+	Type      reflect.Type
+	Size      int // fixed packed size, or Dynamic
+	ValueSize int // packed size of the value given to Layout, or Dynamic
+	Fields    []*FieldLayout
+}
+
+// A FieldLayout describes one packed field. Offsets count from the start of
+// the outer struct. ValueOffset and ValueSize describe the value given to
+// Layout, and are Dynamic when Layout was only given a type.
+type FieldLayout struct {
+	Name     string           // Go field name, or "[i]" for an element of a struct slice
+	Path     string           // path from the outer struct, e.g. "Sections[1].Name"
+	Type     Type             // struc type, with Size_t and Off_t resolved
+	Order    binary.ByteOrder // byte order after Options.Order, nil for structs and unions
+	Offset   int              // fixed offset, or Dynamic
+	Size     int              // fixed size in bytes, or Dynamic
+	Len      int              // array length, Dynamic for sized slices, 0 for scalars
+	Bits     int              // bitfield width, 0 if not a bitfield
+	BitStart int              // bits before this one in its bitfield storage
+	BitShift int              // position of the bitfield's lowest bit in its storage
+	Sizeof   string           // name of the field whose length this field holds
+	Sizefrom string           // name of the field holding this field's length
+
+	ValueOffset int
+	ValueSize   int
+
+	// Fields holds the fields of a nested struct or union, or the elements of
+	// a struct array or slice. When the element count isn't known, a single
+	// "[]" element describes the element type.
+	Fields []*FieldLayout
+}
+
+// Layout describes how v is packed with opts. v may be a struct, a pointer
+// to one, or a nil pointer to a struct type:
+//
+//	schema, err := struc.Layout((*Header)(nil), nil)
+//
+// Given a non-nil value, Layout also reports the actual offsets and sizes
+// Pack would use for it, and the cases currently stored in union fields.
+func Layout(v interface{}, opts *Options) (*Schema, error) {
+	if opts == nil {
+		opts = emptyOptions
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("struc: Layout of nil interface")
+	}
+	val := reflect.ValueOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if val.IsValid() {
+			if val.IsNil() {
+				val = reflect.Value{}
+			} else {
+				val = val.Elem()
+			}
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struc: Layout of %v, not a struct", t)
+	}
+	fields, err := parseFields(reflect.New(t))
+	if err != nil {
+		return nil, err
+	}
+	voff := Dynamic
+	if val.IsValid() {
+		val = packable(val)
+		voff = 0
+	}
+	l := layout{options: opts}
+	s := &Schema{Type: t}
+	s.Fields, s.Size, s.ValueSize, err = l.fields(fields, t, val, "", 0, voff)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type layout struct {
+	options *Options
+	open    map[reflect.Type]bool // struct types being laid out without a value
+}
+
+func addOffset(a, b int) int {
+	if a == Dynamic || b == Dynamic {
+		return Dynamic
+	}
+	return a + b
+}
+
+// fields lays out struct type t starting at fixed offset off and value
+// offset voff, returning the fixed and value sizes. val is invalid when
+// there is no value.
+func (l *layout) fields(fields Fields, t reflect.Type, val reflect.Value, prefix string, off, voff int) ([]*FieldLayout, int, int, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if val.IsValid() {
+		var err error
+		if val, err = structValue(val); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if !val.IsValid() {
+		// a recursive type is described once, inside itself it is Dynamic
+		if l.open[t] {
+			return nil, Dynamic, Dynamic, nil
+		}
+		if l.open == nil {
+			l.open = make(map[reflect.Type]bool)
+		}
+		l.open[t] = true
+		defer delete(l.open, t)
+	}
+	var out []*FieldLayout
+	total, vtotal := 0, 0
+	if !val.IsValid() {
+		vtotal = Dynamic
+	}
+	var groupOff, groupVoff int
+	start, vstart := off, voff
+	for i, f := range fields {
+		if f == nil {
+			continue
+		}
+		sf := t.Field(i)
+		present := val.IsValid() && (f.cond == nil || f.cond.eval(val))
+		err := l.pad(f, start, &off, &total)
+		if err == nil && present {
+			err = l.pad(f, vstart, &voff, &vtotal)
+		}
+		if err != nil {
+			return nil, 0, 0, fieldError(err, t, sf.Name, -1, false)
+		}
+		fl := &FieldLayout{
+			Name:     sf.Name,
+			Path:     prefix + sf.Name,
+			Type:     f.Type.Resolve(l.options),
+			Offset:   off,
+			Bits:     f.bits,
+			BitStart: f.bitStart,
+		}
+		if f.bitGroup != nil {
+			fl.BitShift = int(f.bitGroup.shift(f))
+		}
+		if f.Sizeof != nil {
+			fl.Sizeof = t.FieldByIndex(f.Sizeof).Name
+		}
+		if f.Sizefrom != nil {
+			fl.Sizefrom = t.FieldByIndex(f.Sizefrom).Name
+		}
+		if fl.Type != Struct && fl.Type != UnionType {
+			fl.Order = f.Order
+			if l.options.Order != nil {
+				fl.Order = l.options.Order
+			}
+		}
+		goType := sf.Type
+		if f.Ptr {
+			goType = goType.Elem()
+		}
+		fl.Len = l.length(f, goType)
+
+		var v reflect.Value
+		if val.IsValid() {
+			v = val.Field(i)
+		}
+		if present && f.Ptr && v.IsNil() {
+			return nil, 0, 0, fieldError(fmt.Errorf("cannot pack nil pointer"), t, sf.Name, -1, false)
+		}
+		fl.ValueOffset = Dynamic
+		if val.IsValid() {
+			fl.ValueOffset = voff
+		}
+
+		size, vsize := Dynamic, 0
+		switch {
+		case f.bitGroup != nil:
+			if f.bitGroup.fields[0] == f {
+				groupOff, groupVoff = off, voff
+			}
+			fl.Offset, fl.ValueOffset = groupOff, groupVoff
+			fl.Size, fl.ValueSize = f.bitGroup.size, Dynamic
+			if val.IsValid() {
+				fl.ValueSize = f.bitGroup.size
+			}
+			fl.Order = f.bitGroup.order(l.options)
+			out = append(out, fl)
+			if f.bitGroup.fields[0] == f {
+				off = addOffset(off, f.bitGroup.size)
+				voff = addOffset(voff, f.bitGroup.size)
+				total = addOffset(total, f.bitGroup.size)
+				vtotal = addOffset(vtotal, f.bitGroup.size)
+			}
+			continue
+		case fl.Type == Struct:
+			size, err = l.structField(fl, f, goType, v, present)
+		case fl.Type == UnionType:
+			if present {
+				uv, ufields, err := unionValue(v)
+				if err == nil {
+					fl.Fields, _, _, err = l.fields(ufields, uv.Type(), uv, fl.Path+".", Dynamic, voff)
+				}
+				if err != nil {
+					return nil, 0, 0, fieldError(err, t, sf.Name, -1, false)
+				}
+			}
+		default:
+			size = l.size(f, fl, goType)
+		}
+		if err != nil {
+			return nil, 0, 0, fieldError(err, t, sf.Name, -1, false)
+		}
+		if f.cond != nil {
+			size = Dynamic
+		}
+		if align := l.options.ByteAlign; align > 0 && size != Dynamic && size < align {
+			size = align
+		}
+		if present {
+			if f.Sizeof != nil && f.Type.variable() {
+				if v, err = fields.packValue(val, f, v, l.options, 0); err != nil {
+					return nil, 0, 0, fieldError(err, t, sf.Name, -1, false)
+				}
+			}
+			if vsize, err = f.Size(v, l.options); err != nil {
+				return nil, 0, 0, fieldError(err, t, sf.Name, -1, false)
+			}
+		}
+		fl.Size = size
+		fl.ValueSize = Dynamic
+		if val.IsValid() {
+			fl.ValueSize = vsize
+		}
+		out = append(out, fl)
+		off = addOffset(off, size)
+		voff = addOffset(voff, fl.ValueSize)
+		total = addOffset(total, size)
+		vtotal = addOffset(vtotal, fl.ValueSize)
+	}
+	if total != Dynamic {
+		total += fields.padding(total, l.options)
+	}
+	if vtotal != Dynamic {
+		vtotal += fields.padding(vtotal, l.options)
+	}
+	return out, total, vtotal, nil
+}
+
+// pad adds the padding before field f to total, the size so far of a struct
+// starting at start, and to the matching offset off. An offset= tag fixes
+// the position again after fields of dynamic size.
+func (l *layout) pad(f *Field, start int, off, total *int) error {
+	if *total == Dynamic {
+		if f.offset >= 0 {
+			*off, *total = addOffset(start, f.offset), f.offset
+		}
+		return nil
+	}
+	n, err := f.padding(*total, l.options)
+	if err != nil {
+		return err
+	}
+	*off = addOffset(*off, n)
+	*total += n
+	return nil
+}
+
+// length returns the array length of f as reported in FieldLayout.Len.
+func (l *layout) length(f *Field, goType reflect.Type) int {
+	if !f.Slice && (f.kind != reflect.String || f.Type == CString) {
+		return 0
+	}
+	if f.Sizefrom != nil {
+		return Dynamic
+	}
+	if f.Len > 1 || f.Type == CString || f.Type == Pad {
+		return f.Len
+	}
+	if goType.Kind() == reflect.Array {
+		return goType.Len()
+	}
+	return Dynamic
+}
+
+// size returns the fixed size of a field that isn't a struct or union,
+// matching Field.Size.
+func (l *layout) size(f *Field, fl *FieldLayout, goType reflect.Type) int {
+	typ := fl.Type
+	switch {
+	case f.hasMagic():
+		if f.magic != nil {
+			return len(f.magic)
+		}
+		return typ.Size()
+	case typ == Pad:
+		return f.Len
+	case typ == CString:
+		if f.Slice {
+			return f.Len
+		}
+		return Dynamic
+	case typ.variable(), typ == CustomType, typ.Size() == 0:
+		return Dynamic
+	case f.Slice || f.kind == reflect.String:
+		if fl.Len == Dynamic {
+			return Dynamic
+		}
+		return fl.Len * typ.Size()
+	}
+	return typ.Size()
+}
+
+// structField lays out the fields of a nested struct, or the elements of a
+// struct array or slice, returning the field's fixed size.
+func (l *layout) structField(fl *FieldLayout, f *Field, goType reflect.Type, v reflect.Value, present bool) (int, error) {
+	voff := fl.ValueOffset
+	if !present {
+		v, voff = reflect.Value{}, Dynamic
+	}
+	if !f.Slice {
+		fields, size, _, err := l.fields(f.Fields, goType, v, fl.Path+".", fl.Offset, voff)
+		fl.Fields = fields
+		return size, err
+	}
+	elemType := goType.Elem()
+	count := Dynamic
+	if f.Sizefrom == nil && goType.Kind() == reflect.Array {
+		count = goType.Len()
+	}
+	n := count
+	if v.IsValid() {
+		n = v.Len()
+	}
+	off, size := fl.Offset, 0
+	for i := 0; i < n || (n == Dynamic && i == 0); i++ {
+		name := "[]"
+		var ev reflect.Value
+		if n != Dynamic {
+			name = fmt.Sprintf("[%d]", i)
+			if v.IsValid() {
+				ev = v.Index(i)
+			}
+		}
+		elem := &FieldLayout{
+			Name:        name,
+			Path:        fl.Path + name,
+			Type:        Struct,
+			Offset:      off,
+			ValueOffset: voff,
+		}
+		if n == Dynamic {
+			elem.Offset = Dynamic
+		}
+		fields, esize, evsize, err := l.fields(f.Fields, elemType, ev, elem.Path+".", elem.Offset, voff)
+		if err != nil {
+			return 0, fieldError(err, goType, name, -1, false)
+		}
+		elem.Fields, elem.Size, elem.ValueSize = fields, esize, evsize
+		fl.Fields = append(fl.Fields, elem)
+		off = addOffset(off, esize)
+		voff = addOffset(voff, evsize)
+		size = esize
+	}
+	if count == Dynamic || size == Dynamic {
+		return Dynamic, nil
+	}
+	return count * size, nil
+}
@@ -0,0 +1,153 @@
+package struc
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type layoutPoint struct {
+	X, Y int16
+}
+
+type layoutExample struct {
+	Magic  [4]byte
+	A      uint8 `struc:"uint8:3"`
+	B      uint8 `struc:"uint8:5"`
+	Origin layoutPoint
+	Count  int `struc:"uint16,little,sizeof=Points"`
+	Points []layoutPoint
+	Tail   int32
+	Name   string `struc:"[8]byte"`
+}
+
+func findLayout(fields []*FieldLayout, path string) *FieldLayout {
+	for _, f := range fields {
+		if f.Path == path {
+			return f
+		}
+		if found := findLayout(f.Fields, path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestLayoutType(t *testing.T) {
+	s, err := Layout((*layoutExample)(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != reflect.TypeOf(layoutExample{}) || s.Size != Dynamic || s.ValueSize != Dynamic {
+		t.Fatalf("bad schema: %+v", s)
+	}
+	tests := []struct {
+		path               string
+		typ                Type
+		offset, size, len_ int
+	}{
+		{"Magic", Uint8, 0, 4, 4},
+		{"A", Uint8, 4, 1, 0},
+		{"B", Uint8, 4, 1, 0},
+		{"Origin", Struct, 5, 4, 0},
+		{"Origin.Y", Int16, 7, 2, 0},
+		{"Count", Uint16, 9, 2, 0},
+		{"Points", Struct, 11, Dynamic, Dynamic},
+		{"Points[]", Struct, Dynamic, 4, 0},
+		{"Points[].Y", Int16, Dynamic, 2, 0},
+		{"Tail", Int32, Dynamic, 4, 0},
+		{"Name", Uint8, Dynamic, 8, 8},
+	}
+	for _, test := range tests {
+		f := findLayout(s.Fields, test.path)
+		if f == nil {
+			t.Fatalf("%s: not found", test.path)
+		}
+		if f.Type != test.typ || f.Offset != test.offset || f.Size != test.size || f.Len != test.len_ {
+			t.Errorf("%s: got %v offset %d size %d len %d", test.path, f.Type, f.Offset, f.Size, f.Len)
+		}
+		if f.ValueOffset != Dynamic || f.ValueSize != Dynamic {
+			t.Errorf("%s: value offset %d size %d without a value", test.path, f.ValueOffset, f.ValueSize)
+		}
+	}
+	b := findLayout(s.Fields, "B")
+	if b.Bits != 5 || b.BitStart != 3 || b.BitShift != 0 {
+		t.Errorf("B: bits %d start %d shift %d", b.Bits, b.BitStart, b.BitShift)
+	}
+	count := findLayout(s.Fields, "Count")
+	if count.Sizeof != "Points" || count.Order != binary.LittleEndian {
+		t.Errorf("Count: sizeof %q order %v", count.Sizeof, count.Order)
+	}
+	if points := findLayout(s.Fields, "Points"); points.Sizefrom != "Count" {
+		t.Errorf("Points: sizefrom %q", points.Sizefrom)
+	}
+}
+
+func TestLayoutValue(t *testing.T) {
+	v := &layoutExample{Points: make([]layoutPoint, 3), Name: "name"}
+	s, err := Layout(v, &Options{Order: binary.LittleEndian})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := Sizeof(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ValueSize != size {
+		t.Fatalf("value size %d, Sizeof %d", s.ValueSize, size)
+	}
+	tests := []struct {
+		path         string
+		offset, size int
+	}{
+		{"Origin", 5, 4},
+		{"Points", 11, 12},
+		{"Points[2]", 19, 4},
+		{"Points[2].Y", 21, 2},
+		{"Tail", 23, 4},
+		{"Name", 27, 8},
+	}
+	for _, test := range tests {
+		f := findLayout(s.Fields, test.path)
+		if f == nil {
+			t.Fatalf("%s: not found", test.path)
+		}
+		if f.ValueOffset != test.offset || f.ValueSize != test.size {
+			t.Errorf("%s: got value offset %d size %d", test.path, f.ValueOffset, f.ValueSize)
+		}
+	}
+	if f := findLayout(s.Fields, "Tail"); f.Order != binary.LittleEndian {
+		t.Errorf("Tail: order %v", f.Order)
+	}
+}
+
+func TestLayoutReference(t *testing.T) {
+	for _, v := range []interface{}{reference, arrayReference, sliceReference} {
+		s, err := Layout(v, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := Sizeof(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.ValueSize != size {
+			t.Fatalf("%T: value size %d, Sizeof %d", v, s.ValueSize, size)
+		}
+		if s.Size != Dynamic && s.Size != size {
+			t.Fatalf("%T: fixed size %d, Sizeof %d", v, s.Size, size)
+		}
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	if _, err := Layout(nil, nil); err == nil {
+		t.Error("Layout(nil) succeeded")
+	}
+	if _, err := Layout(3, nil); err == nil {
+		t.Error("Layout(int) succeeded")
+	}
+	if _, err := Layout(&Example{}, nil); err == nil {
+		t.Error("Layout with a nil pointer field succeeded")
+	}
+}
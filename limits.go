@@ -0,0 +1,72 @@
+package struc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A LimitError is returned by Unpack when the input would exceed one of the
+// limits set in Options. It is returned before anything is allocated for the
+// offending field. Pack and Sizeof also return one for MaxDepth, when a
+// value is cyclic.
+type LimitError struct {
+	Limit string // "MaxSliceLen", "MaxTotalBytes" or "MaxDepth"
+	Max   int
+	Value int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// DefaultMaxDepth is the struct nesting limit used when Options.MaxDepth is
+// 0, so recursive types can't exhaust the stack on hostile input or cyclic
+// values.
+const DefaultMaxDepth = 1000
+
+func (o *Options) maxDepth() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// maxPrealloc caps the number of slice elements allocated before they have
+// been read, so a bogus length fails at the end of the input instead.
+const maxPrealloc = 1024
+
+func checkSliceLen(length int, options *Options) error {
+	if options.MaxSliceLen > 0 && length > options.MaxSliceLen {
+		return &LimitError{Limit: "MaxSliceLen", Max: options.MaxSliceLen, Value: int64(length)}
+	}
+	return nil
+}
+
+// makeSlice returns a slice of type t holding length zero elements to unpack
+// into, reusing val's storage when it is large enough. Past maxPrealloc
+// elements the slice starts empty instead, and growSlice adds elements as
+// they are unpacked.
+func makeSlice(t reflect.Type, val reflect.Value, length int) reflect.Value {
+	if val.Kind() == reflect.Slice && val.Cap() >= length {
+		s := val.Slice(0, length)
+		zero := reflect.Zero(t.Elem())
+		for i := 0; i < length; i++ {
+			s.Index(i).Set(zero)
+		}
+		return s
+	}
+	if length > maxPrealloc {
+		return reflect.MakeSlice(t, 0, maxPrealloc)
+	}
+	return reflect.MakeSlice(t, length, length)
+}
+
+// growSlice returns s extended by a zero element if it has no element i.
+func growSlice(s reflect.Value, i int) reflect.Value {
+	if i < s.Len() {
+		return s
+	}
+	return reflect.Append(s, reflect.Zero(s.Type().Elem()))
+}
@@ -0,0 +1,159 @@
+package struc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+type limitBytes struct {
+	Size uint32 `struc:"sizeof=Data"`
+	Data []byte
+}
+
+type limitElem struct {
+	A, B uint64
+}
+
+type limitStructs struct {
+	Size  uint32 `struc:"sizeof=Elems"`
+	Elems []limitElem
+}
+
+type limitVarints struct {
+	Size uint32 `struc:"sizeof=Vals"`
+	Vals []int  `struc:"[]uvarint"`
+}
+
+type limitName struct {
+	Name string `struc:"cstring"`
+}
+
+type limitDepth struct {
+	A     uint8
+	Inner struct {
+		B     uint8
+		Inner struct {
+			C uint8
+		}
+	}
+}
+
+func expectLimit(t *testing.T, err error, limit string) {
+	t.Helper()
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != limit {
+		t.Fatalf("expected %s LimitError, got %v", limit, err)
+	}
+}
+
+func TestMaxSliceLen(t *testing.T) {
+	opts := &Options{MaxSliceLen: 16}
+	hostile := []byte{0x7f, 0xff, 0xff, 0xff, 1, 2, 3}
+	for _, v := range []interface{}{&limitBytes{}, &limitStructs{}, &limitVarints{}} {
+		err := UnpackWithOptions(bytes.NewReader(hostile), v, opts)
+		expectLimit(t, err, "MaxSliceLen")
+	}
+	err := UnpackWithOptions(bytes.NewReader([]byte("too long for the limit\x00")), &limitName{}, opts)
+	expectLimit(t, err, "MaxSliceLen")
+
+	out := &limitBytes{}
+	if err := UnpackWithOptions(bytes.NewReader([]byte{0, 0, 0, 2, 1, 2}), out, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	opts := &Options{MaxTotalBytes: 8}
+	in := []byte{0, 0, 0, 5, 1, 2, 3, 4, 5}
+	err := UnpackWithOptions(bytes.NewReader(in), &limitBytes{}, opts)
+	expectLimit(t, err, "MaxTotalBytes")
+	_, err = UnpackBytesWithOptions(in, &limitBytes{}, opts)
+	expectLimit(t, err, "MaxTotalBytes")
+
+	// the limit applies to each value decoded from a stream
+	dec := NewDecoder(bytes.NewReader([]byte{0, 0, 0, 1, 1, 0, 0, 0, 1, 2}), opts)
+	for i := 0; i < 2; i++ {
+		if err := dec.Decode(&limitBytes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	in := []byte{1, 2, 3}
+	err := UnpackWithOptions(bytes.NewReader(in), &limitDepth{}, &Options{MaxDepth: 2})
+	expectLimit(t, err, "MaxDepth")
+	if err := UnpackWithOptions(bytes.NewReader(in), &limitDepth{}, &Options{MaxDepth: 3}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type limitWrap struct {
+	Size uint64 `struc:"sizeof=Vals"`
+	Vals []int64
+}
+
+func TestHostileLength(t *testing.T) {
+	// 2^61+1 elements of 8 bytes wraps around to 8 bytes
+	wrap := []byte{0x20, 0, 0, 0, 0, 0, 0, 1, 1, 2, 3, 4, 5, 6, 7, 8}
+	if err := Unpack(bytes.NewReader(wrap), &limitWrap{}); err == nil {
+		t.Fatal("failed to reject overflowing length")
+	}
+
+	// a 2GB length with no data behind it must not allocate 2GB
+	hostile := []byte{0x7f, 0xff, 0xff, 0xff, 1, 2, 3}
+	for _, v := range []interface{}{&limitBytes{}, &limitStructs{}, &limitVarints{}} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := Unpack(bytes.NewReader(hostile), v)
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("%T: expected io.ErrUnexpectedEOF, got %v", v, err)
+		}
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+			t.Fatalf("%T: allocated %d bytes", v, alloc)
+		}
+	}
+}
+
+func TestLargeSlice(t *testing.T) {
+	ref := &limitBytes{Data: bytes.Repeat([]byte{1, 2, 3}, 100000)}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	out := &limitBytes{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Data, ref.Data) {
+		t.Fatal("large slice mismatch")
+	}
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	// a chain of nodes with one child each, deeper than DefaultMaxDepth
+	in := bytes.Repeat([]byte{0, 0, 1}, DefaultMaxDepth+1)
+	err := Unpack(bytes.NewReader(in), &treeNode{})
+	expectLimit(t, err, "MaxDepth")
+	in = append(bytes.Repeat([]byte{0, 0, 1}, DefaultMaxDepth-1), 0, 0, 0)
+	if err := Unpack(bytes.NewReader(in), &treeNode{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCyclicPack(t *testing.T) {
+	item := &listItem{Name: "abcd"}
+	item.Next = listNode{true, item}
+	list := &listNode{true, item}
+	_, err := Sizeof(list)
+	expectLimit(t, err, "MaxDepth")
+	_, err = PackInto(make([]byte, 64), list)
+	expectLimit(t, err, "MaxDepth")
+	var buf bytes.Buffer
+	err = PackWithOptions(&buf, list, &Options{MaxDepth: 5})
+	expectLimit(t, err, "MaxDepth")
+}
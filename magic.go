@@ -0,0 +1,127 @@
+package struc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A MagicError is returned by Unpack when a const= or magic= field doesn't
+// hold its expected bytes.
+type MagicError struct {
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *MagicError) Error() string {
+	return fmt.Sprintf("magic mismatch: expected % x, got % x", e.Expected, e.Actual)
+}
+
+// setMagic parses the const= or magic= tag of a field of Go type t.
+func (f *Field) setMagic(t reflect.Type, tag *strucTag) error {
+	if tag.Const != "" && tag.Magic != "" {
+		return fmt.Errorf("field `%s` can't have both const= and magic=", f.Name)
+	}
+	if f.bits > 0 || f.Ptr || tag.Sizeof != "" || tag.Sizefrom != "" {
+		return fmt.Errorf("const= or magic= field `%s` must be a plain value", f.Name)
+	}
+	if tag.Const != "" {
+		if f.Slice || !intKind(f.kind) || f.Type.variable() {
+			return fmt.Errorf("const= field `%s` must be a fixed-size integer", f.Name)
+		}
+		v := reflect.New(t).Elem()
+		switch f.kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(tag.Const, 0, 64)
+			if err != nil || v.OverflowInt(n) {
+				return fmt.Errorf("field `%s` has invalid const=%s", f.Name, tag.Const)
+			}
+			v.SetInt(n)
+		default:
+			n, err := strconv.ParseUint(tag.Const, 0, 64)
+			if err != nil || v.OverflowUint(n) {
+				return fmt.Errorf("field `%s` has invalid const=%s", f.Name, tag.Const)
+			}
+			v.SetUint(n)
+		}
+		f.constant = v
+		return nil
+	}
+	magic := tag.Magic
+	if strings.HasPrefix(magic, `"`) {
+		var err error
+		if magic, err = strconv.Unquote(magic); err != nil {
+			return fmt.Errorf("field `%s` has invalid magic=%s", f.Name, tag.Magic)
+		}
+	}
+	if magic == "" {
+		return fmt.Errorf("field `%s` has an empty magic=", f.Name)
+	}
+	bytesType := f.Type == Pad || f.Type == String ||
+		(f.Type == Uint8 || f.Type == Int8) && (f.Slice || f.kind == reflect.String)
+	if !bytesType {
+		return fmt.Errorf("magic= field `%s` must be a string, byte array or pad", f.Name)
+	}
+	if f.Array || f.Type == Pad || f.Slice && f.Len > 0 {
+		if f.Len != len(magic) {
+			return fmt.Errorf("magic= field `%s` has length %d, not %d", f.Name, f.Len, len(magic))
+		}
+	}
+	f.magic = []byte(magic)
+	f.Len = len(magic)
+	return nil
+}
+
+func (f *Field) hasMagic() bool {
+	return f.magic != nil || f.constant.IsValid()
+}
+
+// magicBytes returns the bytes a const= or magic= field always packs as.
+func (f *Field) magicBytes(options *Options) ([]byte, error) {
+	if f.magic != nil {
+		return f.magic, nil
+	}
+	buf := make([]byte, f.Type.Resolve(options).Size())
+	if _, err := f.packVal(buf, f.constant, 1, options, 0); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (f *Field) packMagic(buf []byte, options *Options) (int, error) {
+	magic, err := f.magicBytes(options)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < len(magic) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(buf, magic), nil
+}
+
+// unpackMagic checks the bytes of a const= or magic= field, and stores them
+// in the field unless it is a `_` placeholder.
+func (f *Field) unpackMagic(r *reader, val reflect.Value, options *Options) error {
+	magic, err := f.magicBytes(options)
+	if err != nil {
+		return err
+	}
+	buf, err := r.next(len(magic), nil)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(buf, magic) {
+		return &MagicError{Expected: magic, Actual: append([]byte(nil), buf...)}
+	}
+	if !val.CanSet() {
+		return nil
+	}
+	length := 1
+	if f.magic != nil {
+		length = len(magic)
+	}
+	return f.Unpack(buf, val, length, options)
+}
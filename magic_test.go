@@ -0,0 +1,120 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type magicHeader struct {
+	_       [4]byte `struc:"magic=PK\x03\x04"`
+	Version uint16  `struc:"little,const=20"`
+	Sig     string  `struc:"magic=\"a,b\""`
+	Magic   uint32  `struc:"const=0x7F454C46"`
+	Size    int32
+}
+
+var magicBytes = []byte{'P', 'K', 3, 4, 20, 0, 'a', ',', 'b', 0x7f, 'E', 'L', 'F', 0, 0, 0, 9}
+
+func TestMagicPack(t *testing.T) {
+	// the Go values of magic fields are ignored
+	in := &magicHeader{Version: 99, Magic: 1, Size: 9}
+	var buf bytes.Buffer
+	if err := Pack(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), magicBytes) {
+		t.Fatalf("got % x, want % x", buf.Bytes(), magicBytes)
+	}
+	out := &magicHeader{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	want := &magicHeader{Version: 20, Sig: "a,b", Magic: 0x7F454C46, Size: 9}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("got %+v, want %+v", out, want)
+	}
+	size, err := Sizeof(in)
+	if err != nil || size != len(magicBytes) {
+		t.Fatalf("Sizeof: %d, %v", size, err)
+	}
+	schema, err := Layout((*magicHeader)(nil), nil)
+	if err != nil || schema.Size != len(magicBytes) {
+		t.Fatalf("Layout size: %v, %v", schema, err)
+	}
+}
+
+func TestMagicMismatch(t *testing.T) {
+	data := append([]byte(nil), magicBytes...)
+	data[12] = 'G'
+	err := Unpack(bytes.NewReader(data), &magicHeader{})
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Path != "Magic" || fe.Offset != 9 {
+		t.Fatalf("got %v", err)
+	}
+	me, ok := fe.Err.(*MagicError)
+	if !ok {
+		t.Fatalf("got %T", fe.Err)
+	}
+	if !bytes.Equal(me.Expected, []byte("\x7fELF")) || !bytes.Equal(me.Actual, []byte("\x7fELG")) {
+		t.Fatalf("got %+v", me)
+	}
+	data[0] = 'X'
+	if err := Unpack(bytes.NewReader(data), &magicHeader{}); err == nil || !strings.Contains(err.Error(), "expected 50 4b 03 04, got 58 4b 03 04") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMagicOrder(t *testing.T) {
+	type ver struct {
+		V uint16 `struc:"const=0x0102"`
+	}
+	var buf bytes.Buffer
+	if err := PackWithOptions(&buf, &ver{}, &Options{Order: binary.LittleEndian}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{2, 1}) {
+		t.Fatalf("got % x", buf.Bytes())
+	}
+}
+
+func TestMagicBad(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		err string
+	}{
+		{&struct {
+			A int8 `struc:"const=300"`
+		}{}, "invalid const=300"},
+		{&struct {
+			A string `struc:"const=1"`
+		}{}, "fixed-size integer"},
+		{&struct {
+			A [3]byte `struc:"magic=PK\x03\x04"`
+		}{}, "has length 3, not 4"},
+		{&struct {
+			A int32 `struc:"magic=PK"`
+		}{}, "string, byte array or pad"},
+		{&struct {
+			A int32 `struc:"const=1,magic=PK"`
+		}{}, "both"},
+	}
+	for _, test := range tests {
+		if _, err := Sizeof(test.v); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%T: expected error containing %q, got %v", test.v, test.err, err)
+		}
+	}
+}
+
+func TestMagicDump(t *testing.T) {
+	var out bytes.Buffer
+	if err := Dump(&out, bytes.NewReader(magicBytes), &magicHeader{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `_ = "PK\x03\x04"`) {
+		t.Fatalf("got:\n%s", out.String())
+	}
+}
@@ -8,6 +8,6 @@ import (
 type Packer interface {
 	Pack(buf []byte, val reflect.Value, options *Options) (int, error)
 	Unpack(r io.Reader, val reflect.Value, options *Options) error
-	Sizeof(val reflect.Value, options *Options) int
+	Sizeof(val reflect.Value, options *Options) (int, error)
 	String() string
 }
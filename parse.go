@@ -12,6 +12,14 @@ import (
 )
 
 // struc:"int32,big,sizeof=Data,skip,sizefrom=Len"
+// struc:"uint16,bytesizeof=Entries"
+// struc:"uint8:3,lsb"
+// struc:"uint32,if=Flags&4"
+// struc:"switch=Kind"
+// struc:"uint32,align=4,offset=16"
+// struc:"uint32,const=0x7F454C46"
+// struc:"[4]byte,magic=PK\x03\x04"
+// struc:"uint32,checksum=crc32,range=Header:Payload"
 
 type strucTag struct {
 	Type     string
@@ -19,6 +27,17 @@ type strucTag struct {
 	Sizeof   string
 	Skip     bool
 	Sizefrom string
+	ByteSize bool // bytesizeof= or bytesizefrom=
+	Bits     string
+	Lsb      bool
+	If       string
+	Switch   string
+	Align    string
+	Offset   string
+	Const    string
+	Magic    string
+	Checksum string
+	Range    string
 }
 
 func parseStrucTag(tag reflect.StructTag) *strucTag {
@@ -32,19 +51,62 @@ func parseStrucTag(tag reflect.StructTag) *strucTag {
 		// and you're mad at me now
 		tagStr = tag.Get("struct")
 	}
-	for _, s := range strings.Split(tagStr, ",") {
+	for _, s := range splitTag(tagStr) {
 		if strings.HasPrefix(s, "sizeof=") {
 			tmp := strings.SplitN(s, "=", 2)
 			t.Sizeof = tmp[1]
 		} else if strings.HasPrefix(s, "sizefrom=") {
 			tmp := strings.SplitN(s, "=", 2)
 			t.Sizefrom = tmp[1]
+		} else if strings.HasPrefix(s, "bytesizeof=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Sizeof = tmp[1]
+			t.ByteSize = true
+		} else if strings.HasPrefix(s, "bytesizefrom=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Sizefrom = tmp[1]
+			t.ByteSize = true
 		} else if s == "big" {
 			t.Order = binary.BigEndian
 		} else if s == "little" {
 			t.Order = binary.LittleEndian
+		} else if strings.HasPrefix(s, "bits=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Bits = tmp[1]
+		} else if strings.HasPrefix(s, "if=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.If = tmp[1]
+		} else if strings.HasPrefix(s, "switch=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Switch = tmp[1]
+		} else if strings.HasPrefix(s, "align=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Align = tmp[1]
+		} else if strings.HasPrefix(s, "offset=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Offset = tmp[1]
+		} else if strings.HasPrefix(s, "const=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Const = tmp[1]
+		} else if strings.HasPrefix(s, "magic=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Magic = tmp[1]
+		} else if strings.HasPrefix(s, "checksum=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Checksum = tmp[1]
+		} else if strings.HasPrefix(s, "range=") {
+			tmp := strings.SplitN(s, "=", 2)
+			t.Range = tmp[1]
+		} else if s == "msb" {
+			t.Lsb = false
+		} else if s == "lsb" {
+			t.Lsb = true
 		} else if s == "skip" {
 			t.Skip = true
+		} else if i := strings.Index(s, ":"); i >= 0 {
+			// "uint8:3" is shorthand for "uint8,bits=3"
+			t.Type = s[:i]
+			t.Bits = s[i+1:]
 		} else {
 			t.Type = s
 		}
@@ -52,17 +114,41 @@ func parseStrucTag(tag reflect.StructTag) *strucTag {
 	return t
 }
 
+// splitTag splits a struc tag on commas outside of double quotes, so a
+// quoted magic= value may contain commas.
+func splitTag(tag string) []string {
+	var out []string
+	quoted, start := false, 0
+	for i := 0; i < len(tag); i++ {
+		switch tag[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				out = append(out, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, tag[start:])
+}
+
 var typeLenRe = regexp.MustCompile(`^\[(\d*)\]`)
 
 func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
 	tag = parseStrucTag(f.Tag)
 	var ok bool
 	fd = &Field{
-		Name:  f.Name,
-		Len:   1,
-		Order: tag.Order,
-		Slice: false,
-		kind:  f.Type.Kind(),
+		Name:   f.Name,
+		Len:    1,
+		Order:  tag.Order,
+		Slice:  false,
+		kind:   f.Type.Kind(),
+		offset: -1,
 	}
 	switch fd.kind {
 	case reflect.Array:
@@ -101,6 +187,9 @@ func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
 				fd.Len, err = strconv.Atoi(first)
 			}
 		}
+		if err == nil && fd.Type == CString {
+			err = fd.setCString(f.Type, len(match) > 0)
+		}
 		return
 	}
 	// the user didn't specify a type
@@ -113,7 +202,7 @@ func parseField(f reflect.StructField) (fd *Field, tag *strucTag, err error) {
 		if defTypeOk {
 			fd.Type = fd.defType
 		} else {
-			err = errors.New(fmt.Sprintf("struc: Could not resolve field '%v' type '%v'.", f.Name, f.Type))
+			err = errors.New(fmt.Sprintf("Could not resolve field '%v' type '%v'.", f.Name, f.Type))
 		}
 	}
 	return
@@ -130,64 +219,219 @@ func parseFieldsLocked(v reflect.Value) (Fields, error) {
 	}
 	sizeofMap := make(map[string][]int)
 	fields := make(Fields, v.NumField())
+	// recursive types reuse fields while it is filled in, which works
+	// because slices of the same array see each element as it is set
+	parsing[t] = fields
+	defer delete(parsing, t)
 	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		f, tag, err := parseField(field)
-		if tag.Skip {
-			continue
-		}
+		f, err := parseStructField(v, fields, sizeofMap, i)
 		if err != nil {
+			return nil, fieldError(err, t, t.Field(i).Name, -1, false)
+		}
+		fields[i] = f
+	}
+	fields.groupBits()
+	return fields, nil
+}
+
+// parseStructField parses field i of struct v, returning nil for fields
+// that are skipped.
+func parseStructField(v reflect.Value, fields Fields, sizeofMap map[string][]int, i int) (*Field, error) {
+	t := v.Type()
+	field := t.Field(i)
+	f, tag, err := parseField(field)
+	if tag.Skip {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	placeholder := field.Name == "_" && (tag.Const != "" || tag.Magic != "")
+	if !v.Field(i).CanSet() && !placeholder {
+		return nil, nil
+	}
+	f.Index = i
+	if tag.Bits != "" {
+		if err := f.setBits(tag); err != nil {
 			return nil, err
 		}
-		if !v.Field(i).CanSet() {
-			continue
+	}
+	if tag.Sizeof != "" {
+		target, ok := t.FieldByName(tag.Sizeof)
+		if !ok {
+			return nil, fmt.Errorf("`sizeof=%s` field does not exist", tag.Sizeof)
 		}
-		f.Index = i
-		if tag.Sizeof != "" {
-			target, ok := t.FieldByName(tag.Sizeof)
-			if !ok {
-				return nil, fmt.Errorf("struc: `sizeof=%s` field does not exist", tag.Sizeof)
-			}
-			f.Sizeof = target.Index
-			sizeofMap[tag.Sizeof] = field.Index
+		if !intKind(f.kind) || f.Slice || f.Ptr {
+			return nil, fmt.Errorf("`sizeof=%s` field must be an integer", tag.Sizeof)
 		}
-		if sizefrom, ok := sizeofMap[field.Name]; ok {
-			f.Sizefrom = sizefrom
+		switch target.Type.Kind() {
+		case reflect.Slice, reflect.Array, reflect.String:
+		default:
+			return nil, fmt.Errorf("`sizeof=%s` must refer to a slice, array or string", tag.Sizeof)
 		}
-		if tag.Sizefrom != "" {
-			source, ok := t.FieldByName(tag.Sizefrom)
-			if !ok {
-				return nil, fmt.Errorf("struc: `sizefrom=%s` field does not exist", tag.Sizefrom)
-			}
-			f.Sizefrom = source.Index
+		if tag.ByteSize && len(target.Index) > 1 {
+			return nil, fmt.Errorf("`bytesizeof=%s` must refer to a field of the same struct", tag.Sizeof)
 		}
-		if f.Len == -1 && f.Sizefrom == nil {
-			return nil, fmt.Errorf("struc: field `%s` is a slice with no length or sizeof field", field.Name)
+		f.Sizeof = target.Index
+		f.byteLen = tag.ByteSize
+		sizeofMap[tag.Sizeof] = field.Index
+	}
+	if sizefrom, ok := sizeofMap[field.Name]; ok {
+		f.Sizefrom = sizefrom
+		f.byteLen = fields[sizefrom[0]].byteLen
+	}
+	if tag.Sizefrom != "" {
+		source, ok := t.FieldByName(tag.Sizefrom)
+		if !ok {
+			return nil, fmt.Errorf("`sizefrom=%s` field does not exist", tag.Sizefrom)
 		}
-		// recurse into nested structs
-		// TODO: handle loops (probably by indirecting the []Field and putting pointer in cache)
-		if f.Type == Struct {
-			typ := field.Type
-			if f.Ptr {
-				typ = typ.Elem()
-			}
-			if f.Slice {
-				typ = typ.Elem()
-			}
-			f.Fields, err = parseFieldsLocked(reflect.New(typ))
-			if err != nil {
-				return nil, err
-			}
+		f.Sizefrom = source.Index
+		f.byteLen = tag.ByteSize
+	}
+	if f.Sizefrom != nil {
+		if source := t.FieldByIndex(f.Sizefrom); !intKind(source.Type.Kind()) {
+			return nil, fmt.Errorf("sizeof field `%s` is not an integer", source.Name)
 		}
-		fields[i] = f
 	}
-	return fields, nil
+	if f.Array && f.Len > field.Type.Len() {
+		return nil, fmt.Errorf("field `%s` has length %d, longer than its array", field.Name, f.Len)
+	}
+	switch field.Type.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String:
+	default:
+		if f.Slice && f.Type != Pad && f.Type != CustomType {
+			return nil, fmt.Errorf("field `%s` has a length but is not an array, slice or string", field.Name)
+		}
+	}
+	if err := f.checkType(); err != nil {
+		return nil, err
+	}
+	if f.Type == CString && f.Sizefrom != nil {
+		return nil, fmt.Errorf("cstring field `%s` cannot use sizefrom", field.Name)
+	}
+	if f.byteLen && f.Sizefrom != nil && (f.Ptr || f.Type == CustomType || f.Type == Pad || f.Type == UnionType) {
+		return nil, fmt.Errorf("field `%s` can't have its length in bytes", field.Name)
+	}
+	if tag.If != "" {
+		if f.cond, err = parseCondition(t, tag.If, i); err != nil {
+			return nil, err
+		}
+	}
+	if tag.Const != "" || tag.Magic != "" {
+		if err := f.setMagic(field.Type, tag); err != nil {
+			return nil, err
+		}
+	}
+	if tag.Checksum != "" || tag.Range != "" {
+		if err := f.setChecksum(t, i, tag); err != nil {
+			return nil, err
+		}
+	}
+	if tag.Align != "" {
+		if f.alignment, err = strconv.Atoi(tag.Align); err != nil || f.alignment < 1 {
+			return nil, fmt.Errorf("field `%s` has invalid align=%s", field.Name, tag.Align)
+		}
+	}
+	if tag.Offset != "" {
+		if f.offset, err = strconv.Atoi(tag.Offset); err != nil || f.offset < 0 {
+			return nil, fmt.Errorf("field `%s` has invalid offset=%s", field.Name, tag.Offset)
+		}
+	}
+	if f.Type == UnionType {
+		if tag.Switch == "" {
+			return nil, fmt.Errorf("union field `%s` has no switch= field", field.Name)
+		}
+		source, ok := t.FieldByName(tag.Switch)
+		if !ok {
+			return nil, fmt.Errorf("`switch=%s` field does not exist", tag.Switch)
+		}
+		j := source.Index[0]
+		if len(source.Index) > 1 || j >= i || fields[j] == nil {
+			return nil, fmt.Errorf("`switch=%s` must refer to an earlier field", tag.Switch)
+		}
+		switch fields[j].kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("`switch=%s` field is not an integer", tag.Switch)
+		}
+		if f.Slice || f.Ptr || fields[j].Slice || fields[j].bits > 0 {
+			return nil, fmt.Errorf("union field `%s` and its switch= field must be scalars", field.Name)
+		}
+		f.switchFrom = source.Index
+		f.unionType = field.Type
+		fields[j].switchFor = field.Index
+	}
+	if f.Len == -1 && f.Sizefrom == nil {
+		return nil, fmt.Errorf("field `%s` is a slice with no length or sizeof field", field.Name)
+	}
+	// recurse into nested structs
+	if f.Type == Struct {
+		typ := field.Type
+		if f.Ptr {
+			typ = typ.Elem()
+		}
+		if f.Slice {
+			typ = typ.Elem()
+		}
+		if fields, ok := parsing[typ]; ok {
+			f.Fields = fields
+		} else if f.Fields, err = parseFieldsLocked(reflect.New(typ)); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func intKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// checkType rejects Go types that can't be packed as the field's type, so
+// Pack and Unpack don't have to.
+func (f *Field) checkType() error {
+	switch f.Type {
+	case CustomType, CString, UnionType, Pad:
+		return nil
+	case Struct:
+		if f.kind == reflect.Struct {
+			return nil
+		}
+	case String:
+		if f.kind == reflect.String && !f.Ptr {
+			return nil
+		}
+	case Float32, Float64:
+		if f.kind == reflect.Float32 || f.kind == reflect.Float64 {
+			return nil
+		}
+	case Bool, Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64, SizeType, OffType:
+		// strings can hold arrays of bytes (or anything else)
+		if intKind(f.kind) || f.kind == reflect.Bool || (f.kind == reflect.String && f.Slice && !f.Ptr) {
+			return nil
+		}
+	case Uvarint, Varint, Sleb128:
+		if intKind(f.kind) || f.kind == reflect.Bool {
+			return nil
+		}
+	default:
+		return fmt.Errorf("field `%s` has unsupported type %v", f.Name, f.Type)
+	}
+	return fmt.Errorf("field `%s` of kind %s cannot be packed as %s", f.Name, f.kind, f.Type)
 }
 
 var fieldCache = make(map[reflect.Type]Fields)
 var fieldCacheLock sync.RWMutex
 var parseLock sync.Mutex
 
+// parsing holds the fields of the types being parsed under parseLock.
+var parsing = make(map[reflect.Type]Fields)
+
 func fieldCacheLookup(t reflect.Type) Fields {
 	fieldCacheLock.RLock()
 	defer fieldCacheLock.RUnlock()
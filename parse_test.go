@@ -3,6 +3,7 @@ package struc
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -60,3 +61,121 @@ func TestNestedParseError(t *testing.T) {
 		t.Fatal("failed to error on bad nested struct")
 	}
 }
+
+type treeNode struct {
+	Value    uint16
+	N        uint8 `struc:"sizeof=Children"`
+	Children []treeNode
+}
+
+// listNode and listItem refer to each other through a conditional pointer.
+type listNode struct {
+	HasItem bool
+	Item    *listItem `struc:"if=HasItem"`
+}
+
+type listItem struct {
+	Name string `struc:"[4]byte"`
+	Next listNode
+}
+
+// recursiveTLV is recursive through the case type of its union.
+type recursiveTLV struct {
+	Kind uint8
+	Body recursiveBody `struc:"switch=Kind"`
+}
+
+type recursiveBody interface {
+	isRecursiveBody()
+}
+
+type recursiveList struct {
+	N     uint8 `struc:"sizeof=Items"`
+	Items []recursiveTLV
+}
+
+func (*recursiveList) isRecursiveBody() {}
+
+func init() {
+	RegisterUnion((*recursiveBody)(nil), 1, &recursiveList{})
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	tree := &treeNode{Value: 1, Children: []treeNode{
+		{Value: 2},
+		{Value: 3, Children: []treeNode{{Value: 4}}},
+	}}
+	var buf bytes.Buffer
+	if err := Pack(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 1, 2, 0, 2, 0, 0, 3, 1, 0, 4, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("packed % x, want % x", buf.Bytes(), want)
+	}
+	out := &treeNode{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	tree.N, tree.Children[1].N = 2, 1
+	if !reflect.DeepEqual(tree, out) {
+		t.Fatalf("got %+v, want %+v", out, tree)
+	}
+
+	list := &listNode{true, &listItem{"abcd", listNode{true, &listItem{Name: "efgh"}}}}
+	buf.Reset()
+	if err := Pack(&buf, list); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "\x01abcd\x01efgh\x00" {
+		t.Fatalf("packed %q", got)
+	}
+	outList := &listNode{}
+	if err := Unpack(&buf, outList); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, outList) {
+		t.Fatalf("got %+v, want %+v", outList, list)
+	}
+
+	tlv := &recursiveTLV{Kind: 1, Body: &recursiveList{N: 1, Items: []recursiveTLV{
+		{Kind: 1, Body: &recursiveList{}},
+	}}}
+	options := &Options{CABI: ABIAmd64}
+	buf.Reset()
+	if err := PackWithOptions(&buf, tlv, options); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{1, 1, 1, 0}) {
+		t.Fatalf("packed % x", buf.Bytes())
+	}
+	outTLV := &recursiveTLV{}
+	if err := UnpackWithOptions(&buf, outTLV, options); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tlv, outTLV) {
+		t.Fatalf("got %+v, want %+v", outTLV, tlv)
+	}
+}
+
+func TestRecursiveLayout(t *testing.T) {
+	schema, err := Layout((*treeNode)(nil), &Options{CABI: ABIAmd64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Size != Dynamic || len(schema.Fields) != 3 {
+		t.Fatalf("got %+v", schema)
+	}
+	// the element type is described once, without its own children
+	children := schema.Fields[2]
+	if len(children.Fields) != 1 || children.Fields[0].Fields != nil || children.Fields[0].Size != Dynamic {
+		t.Fatalf("children %+v", children.Fields)
+	}
+	var buf bytes.Buffer
+	if err := Dump(&buf, bytes.NewReader([]byte{0, 1, 1, 0, 2, 0}), &treeNode{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Children[0].Value = 2") {
+		t.Fatalf("dump:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,202 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+)
+
+// reader wraps the source passed to Unpack. It counts consumed bytes, and
+// when unpacking from a byte slice it hands out subslices instead of copying.
+type reader struct {
+	r   io.Reader
+	buf []byte // remaining input when unpacking from a byte slice
+	off int64  // bytes consumed so far
+
+	scratch []byte  // reused by next when reading from r
+	small   [8]byte // backs scratch for short reads, saving an allocation
+
+	depth int   // struct nesting depth
+	start int64 // offset where the current MaxTotalBytes limit began
+	max   int64 // options.MaxTotalBytes, 0 for no limit
+
+	recording int    // structs with checksums being unpacked
+	rec       []byte // bytes consumed while recording
+}
+
+// record keeps a copy of consumed bytes while a checksum is pending.
+func (r *reader) record(p []byte) {
+	if r.recording > 0 {
+		r.rec = append(r.rec, p...)
+	}
+}
+
+// limit starts enforcing options.MaxTotalBytes from the current offset.
+func (r *reader) limit(options *Options) {
+	r.start = r.off
+	r.max = int64(options.MaxTotalBytes)
+}
+
+// reserve checks that n more bytes may be read.
+func (r *reader) reserve(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid length %d", n)
+	}
+	if total := r.off - r.start + int64(n); r.max > 0 && total > r.max {
+		return &LimitError{Limit: "MaxTotalBytes", Max: int(r.max), Value: total}
+	}
+	return nil
+}
+
+// maxScratch limits the size of buffers kept around by a reader.
+const maxScratch = 64 * 1024
+
+func (r *reader) Read(p []byte) (int, error) {
+	if left := r.max - (r.off - r.start); r.max > 0 && int64(len(p)) > left {
+		if left <= 0 && len(p) > 0 {
+			return 0, r.reserve(len(p))
+		}
+		p = p[:left]
+	}
+	if r.r == nil {
+		if len(r.buf) == 0 {
+			if len(p) == 0 {
+				return 0, nil
+			}
+			return 0, io.EOF
+		}
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		r.off += int64(n)
+		r.record(p[:n])
+		return n, nil
+	}
+	n, err := r.r.Read(p)
+	r.off += int64(n)
+	r.record(p[:n])
+	return n, err
+}
+
+func (r *reader) ReadByte() (byte, error) {
+	if r.r == nil {
+		if err := r.reserve(1); err != nil {
+			return 0, err
+		}
+		if len(r.buf) == 0 {
+			return 0, io.EOF
+		}
+		b := r.buf[0]
+		r.record(r.buf[:1])
+		r.buf = r.buf[1:]
+		r.off++
+		return b, nil
+	}
+	if _, err := io.ReadFull(r, r.small[:1]); err != nil {
+		return 0, err
+	}
+	return r.small[0], nil
+}
+
+// next returns the next n bytes, using tmp as storage if it is large enough.
+// The result is only valid until the next read.
+func (r *reader) next(n int, tmp []byte) ([]byte, error) {
+	if err := r.reserve(n); err != nil {
+		return nil, err
+	}
+	if r.r != nil {
+		var out []byte
+		var err error
+		if len(tmp) < n && n > maxScratch {
+			out, err = r.readLarge(n)
+		} else {
+			if len(tmp) < n {
+				if cap(r.scratch) < n {
+					if n <= len(r.small) {
+						r.scratch = r.small[:]
+					} else {
+						r.scratch = make([]byte, n)
+					}
+				}
+				tmp = r.scratch[:n]
+			}
+			out, err = readN(r.r, n, tmp, &r.off)
+		}
+		if err == nil {
+			r.record(out)
+		}
+		return out, err
+	}
+	if len(r.buf) < n {
+		if len(r.buf) == 0 {
+			return nil, io.EOF
+		}
+		r.off += int64(len(r.buf))
+		r.buf = nil
+		return nil, io.ErrUnexpectedEOF
+	}
+	out := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	r.off += int64(n)
+	r.record(out)
+	return out, nil
+}
+
+// skip discards n bytes of alignment padding. Padding always follows other
+// data, so running out of input is unexpected.
+func (r *reader) skip(n int) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := r.next(n, nil)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readLarge reads n bytes in growing chunks, so memory is only allocated as
+// data arrives rather than trusting n up front.
+func (r *reader) readLarge(n int) ([]byte, error) {
+	buf := make([]byte, 0, maxScratch)
+	for len(buf) < n {
+		if len(buf) == cap(buf) {
+			size := 2 * cap(buf)
+			if size > n {
+				size = n
+			}
+			tmp := make([]byte, len(buf), size)
+			copy(tmp, buf)
+			buf = tmp
+		}
+		read, err := io.ReadFull(r.r, buf[len(buf):cap(buf)])
+		r.off += int64(read)
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// readN reads exactly n bytes from r, using tmp as storage if it is large
+// enough, and adds the number of bytes read to *off.
+func readN(r io.Reader, n int, tmp []byte, off *int64) ([]byte, error) {
+	if rd, ok := r.(*reader); ok {
+		return rd.next(n, tmp)
+	}
+	buf := tmp
+	if len(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	read, err := io.ReadFull(r, buf)
+	if off != nil {
+		*off += int64(read)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,496 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Record holds the fields of a Format by name. Nested structs are Records
+// and arrays of them are []Record. Other fields hold the Go type struc would
+// use for them: integers and floats of the tagged size, []byte for byte
+// arrays, string for string and cstring fields, and slices of those.
+type Record map[string]interface{}
+
+// A Format describes a struct at runtime, for formats that aren't known when
+// compiling. Fields are declared in order with the same tags as Go structs,
+// except that the type is required and refers to other fields by their
+// Format names:
+//
+//	f := struc.NewFormat().
+//		Field("len", "uint16,sizeof=data").
+//		Field("data", "[]byte")
+//
+// Additional tag types "string" and "[N]string" hold Go strings packed as
+// raw bytes. Formats are packed and unpacked by the same code as Go structs.
+type Format struct {
+	fields []formatField
+	err    error
+
+	mu  sync.Mutex
+	typ reflect.Type
+}
+
+type formatField struct {
+	name, goName, tag string
+	sub               *Format
+	pad               bool
+}
+
+// NewFormat returns an empty Format.
+func NewFormat() *Format {
+	return &Format{}
+}
+
+// Field appends a field described by a struc tag, such as "uint32,little".
+// Errors are reported when the Format is used.
+func (f *Format) Field(name, tag string) *Format {
+	return f.add(formatField{name: name, tag: tag})
+}
+
+// Struct appends a nested struct field. tag may give an array length such
+// as "[4]", or "[]" with a sizefrom= field.
+func (f *Format) Struct(name, tag string, sub *Format) *Format {
+	if sub == nil || sub == f {
+		f.setErr(fmt.Errorf("struc: Format field %q has an invalid Format", name))
+		return f
+	}
+	return f.add(formatField{name: name, tag: tag, sub: sub})
+}
+
+func (f *Format) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+var formatNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+func (f *Format) add(field formatField) *Format {
+	if !formatNameRe.MatchString(field.name) {
+		f.setErr(fmt.Errorf("struc: invalid Format field name %q", field.name))
+		return f
+	}
+	field.goName = strings.ToUpper(field.name[:1]) + field.name[1:]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, other := range f.fields {
+		if other.goName == field.goName {
+			f.err = fmt.Errorf("struc: Format fields %q and %q collide", other.name, field.name)
+		}
+	}
+	f.fields = append(f.fields, field)
+	f.typ = nil
+	return f
+}
+
+// Type returns the Go struct type Records are converted to for packing.
+func (f *Format) Type() (reflect.Type, error) {
+	return f.resolve(make(map[*Format]bool))
+}
+
+// resolve builds the Go type of f. visiting holds the Formats being resolved
+// further up, to reject Formats that contain themselves. f.mu isn't held
+// while resolving nested Formats, which lock their own.
+func (f *Format) resolve(visiting map[*Format]bool) (reflect.Type, error) {
+	f.mu.Lock()
+	err, typ := f.err, f.typ
+	fields := append([]formatField(nil), f.fields...)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if typ != nil {
+		return typ, nil
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("struc: Format has no fields")
+	}
+	visiting[f] = true
+	defer delete(visiting, f)
+	goNames := make(map[string]string, len(fields))
+	for _, field := range fields {
+		goNames[field.name] = field.goName
+	}
+	var structFields []reflect.StructField
+	for i := range fields {
+		field := &fields[i]
+		var sub reflect.Type
+		if field.sub != nil {
+			if visiting[field.sub] {
+				return nil, fmt.Errorf("struc: Format field %q contains its own Format", field.name)
+			}
+			if sub, err = field.sub.resolve(visiting); err != nil {
+				return nil, fmt.Errorf("struc: Format field %q: %v", field.name, err)
+			}
+		}
+		typ, tag, err := field.goType(goNames, sub)
+		if err != nil {
+			return nil, fmt.Errorf("struc: Format field %q: %v", field.name, err)
+		}
+		structFields = append(structFields, reflect.StructField{
+			Name: field.goName,
+			Type: typ,
+			Tag:  reflect.StructTag("struc:" + strconv.Quote(tag)),
+		})
+	}
+	typ = reflect.StructOf(structFields)
+	if _, err := parseFields(reflect.New(typ)); err != nil {
+		return nil, f.error(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// fields are only appended, so an unchanged count means f wasn't
+	// modified while unlocked
+	if len(f.fields) == len(fields) {
+		for i := range fields {
+			f.fields[i].pad = fields[i].pad
+		}
+		f.typ = typ
+	}
+	return typ, nil
+}
+
+var formatGoTypes = map[Type]reflect.Type{
+	Bool:     reflect.TypeOf(false),
+	Int8:     reflect.TypeOf(int8(0)),
+	Uint8:    reflect.TypeOf(uint8(0)),
+	Int16:    reflect.TypeOf(int16(0)),
+	Uint16:   reflect.TypeOf(uint16(0)),
+	Int32:    reflect.TypeOf(int32(0)),
+	Uint32:   reflect.TypeOf(uint32(0)),
+	Int64:    reflect.TypeOf(int64(0)),
+	Uint64:   reflect.TypeOf(uint64(0)),
+	Float32:  reflect.TypeOf(float32(0)),
+	Float64:  reflect.TypeOf(float64(0)),
+	CString:  reflect.TypeOf(""),
+	Pad:      reflect.TypeOf(uint8(0)),
+	Uvarint:  reflect.TypeOf(uint64(0)),
+	Varint:   reflect.TypeOf(int64(0)),
+	Sleb128:  reflect.TypeOf(int64(0)),
+	SizeType: reflect.TypeOf(uint64(0)),
+	OffType:  reflect.TypeOf(int64(0)),
+}
+
+var formatRefs = []string{"sizeof=", "sizefrom=", "bytesizeof=", "bytesizefrom=", "switch="}
+
+var formatIdentRe = regexp.MustCompile(`\b[A-Za-z_][A-Za-z0-9_]*`)
+
+// goType returns the Go type of a field, and its tag with field references
+// renamed to Go names. sub is the resolved type of a nested Format.
+func (field *formatField) goType(goNames map[string]string, sub reflect.Type) (reflect.Type, string, error) {
+	rename := func(name string) string {
+		if goName, ok := goNames[name]; ok {
+			return goName
+		}
+		return name
+	}
+	tag := parseStrucTag(reflect.StructTag("struc:" + strconv.Quote(field.tag)))
+	length := typeLenRe.FindStringSubmatch(tag.Type)
+	pure := typeLenRe.ReplaceAllLiteralString(tag.Type, "")
+	var parts []string
+	typed := false
+	for _, s := range splitTag(field.tag) {
+		for _, prefix := range formatRefs {
+			if strings.HasPrefix(s, prefix) {
+				s = prefix + rename(s[len(prefix):])
+			}
+		}
+		switch {
+		case strings.HasPrefix(s, "range="):
+			names := strings.Split(s[len("range="):], ":")
+			for i := range names {
+				names[i] = rename(names[i])
+			}
+			s = "range=" + strings.Join(names, ":")
+		case strings.HasPrefix(s, "if="):
+			s = "if=" + formatIdentRe.ReplaceAllStringFunc(s[len("if="):], rename)
+		case s == tag.Type && s != "":
+			// the type is rewritten below
+			typed = true
+			continue
+		}
+		parts = append(parts, s)
+	}
+	var typ reflect.Type
+	typeTag := tag.Type
+	switch {
+	case field.sub != nil:
+		if pure != "" {
+			return nil, "", fmt.Errorf("struct field has type %q", tag.Type)
+		}
+		typ, typeTag = sub, ""
+		if length != nil && length[1] != "" {
+			n, _ := strconv.Atoi(length[1])
+			typ = reflect.ArrayOf(n, sub)
+		} else if length != nil {
+			typ = reflect.SliceOf(sub)
+		}
+	case pure == "":
+		return nil, "", fmt.Errorf("no type in tag %q", field.tag)
+	case pure == "string":
+		typ, typeTag = reflect.TypeOf(""), ""
+		if length != nil && length[1] != "" {
+			typeTag = "[" + length[1] + "]byte"
+		}
+	default:
+		t, ok := typeLookup[pure]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown type %q", pure)
+		}
+		typ = formatGoTypes[t]
+		field.pad = t == Pad
+		if !typed {
+			// bitfield shorthand like "uint8:3", left in place
+			typeTag = ""
+		}
+		if length != nil && t != CString {
+			typ = reflect.SliceOf(typ)
+		}
+	}
+	if typeTag != "" {
+		parts = append([]string{typeTag}, parts...)
+	}
+	return typ, strings.Join(parts, ","), nil
+}
+
+// error renames the Go field names in a FieldError path to Format names,
+// and drops its Type, which is the generated struct.
+func (f *Format) error(err error) error {
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return err
+	}
+	fe.Path = f.path(fe.Path)
+	fe.Type = nil
+	return fe
+}
+
+// path converts a field path of the Format's Go type, such as
+// "Items[0].X", to Format names.
+func (f *Format) path(goPath string) string {
+	var out []string
+	cur := f
+	for _, seg := range strings.Split(goPath, ".") {
+		name, index := seg, ""
+		if i := strings.Index(seg, "["); i >= 0 {
+			name, index = seg[:i], seg[i:]
+		}
+		var next *Format
+		if cur != nil {
+			for _, field := range cur.fields {
+				if field.goName == name {
+					name, next = field.name, field.sub
+				}
+			}
+		}
+		out = append(out, name+index)
+		cur = next
+	}
+	return strings.Join(out, ".")
+}
+
+// Pack packs rec. Fields missing from rec are packed as zero, and sizeof=
+// fields are filled in as with Go structs.
+func (f *Format) Pack(w io.Writer, rec Record, options *Options) error {
+	v, err := f.value(rec)
+	if err != nil {
+		return err
+	}
+	return f.error(PackWithOptions(w, v.Interface(), options))
+}
+
+// Sizeof returns the packed size of rec.
+func (f *Format) Sizeof(rec Record, options *Options) (int, error) {
+	v, err := f.value(rec)
+	if err != nil {
+		return 0, err
+	}
+	n, err := SizeofWithOptions(v.Interface(), options)
+	return n, f.error(err)
+}
+
+// Unpack unpacks a Record from r.
+func (f *Format) Unpack(r io.Reader, options *Options) (Record, error) {
+	typ, err := f.Type()
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(typ)
+	if err := UnpackWithOptions(r, v.Interface(), options); err != nil {
+		return nil, f.error(err)
+	}
+	return f.record(v.Elem()), nil
+}
+
+// Dump unpacks a Record from r like Unpack, writing an annotated hexdump of
+// the bytes consumed to w as Dump does.
+func (f *Format) Dump(w io.Writer, r io.Reader, options *Options) error {
+	typ, err := f.Type()
+	if err != nil {
+		return err
+	}
+	return dump(w, r, reflect.New(typ).Interface(), options, f)
+}
+
+// value converts rec to a pointer to the Format's struct type.
+func (f *Format) value(rec Record) (reflect.Value, error) {
+	typ, err := f.Type()
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	v := reflect.New(typ)
+	if err := f.fill(v.Elem(), rec, ""); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+func (f *Format) fill(v reflect.Value, rec map[string]interface{}, prefix string) error {
+	known := make(map[string]bool, len(f.fields))
+	for _, field := range f.fields {
+		known[field.name] = true
+		x, ok := rec[field.name]
+		if !ok || x == nil {
+			continue
+		}
+		path := prefix + field.name
+		fv := v.FieldByName(field.goName)
+		var err error
+		if field.sub != nil {
+			err = field.sub.fillStruct(fv, x, path)
+		} else {
+			err = setRecordValue(fv, reflect.ValueOf(x))
+		}
+		if err != nil {
+			if _, ok := err.(recordError); ok {
+				return err
+			}
+			return recordError(fmt.Sprintf("struc: Record field %s: %v", path, err))
+		}
+	}
+	for name := range rec {
+		if !known[name] {
+			return recordError(fmt.Sprintf("struc: Record field %s%s is not in the Format", prefix, name))
+		}
+	}
+	return nil
+}
+
+// recordError is an error converting a Record, which already names the
+// field, so nested fields aren't wrapped again.
+type recordError string
+
+func (e recordError) Error() string {
+	return string(e)
+}
+
+// fillStruct sets a nested struct field, or an array or slice of them.
+func (f *Format) fillStruct(v reflect.Value, x interface{}, path string) error {
+	if v.Kind() == reflect.Struct {
+		rec, ok := recordMap(x)
+		if !ok {
+			return fmt.Errorf("%T is not a Record", x)
+		}
+		return f.fill(v, rec, path+".")
+	}
+	xv := reflect.ValueOf(x)
+	if xv.Kind() != reflect.Slice && xv.Kind() != reflect.Array {
+		return fmt.Errorf("%T is not a slice of Records", x)
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), xv.Len(), xv.Len()))
+	} else if xv.Len() > v.Len() {
+		return fmt.Errorf("%d elements exceed array length %d", xv.Len(), v.Len())
+	}
+	for i := 0; i < xv.Len(); i++ {
+		rec, ok := recordMap(xv.Index(i).Interface())
+		if !ok {
+			return fmt.Errorf("element %d is %T, not a Record", i, xv.Index(i).Interface())
+		}
+		if err := f.fill(v.Index(i), rec, fmt.Sprintf("%s[%d].", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordMap(x interface{}) (map[string]interface{}, bool) {
+	switch m := x.(type) {
+	case Record:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+// setRecordValue stores x in v, converting numbers, strings and slices.
+func setRecordValue(v, x reflect.Value) error {
+	for x.Kind() == reflect.Interface && !x.IsNil() {
+		x = x.Elem()
+	}
+	switch {
+	case x.Type().AssignableTo(v.Type()):
+		v.Set(x)
+		return nil
+	case v.Kind() == reflect.Slice && (x.Kind() == reflect.Slice || x.Kind() == reflect.Array):
+		if v.Type().Elem().Kind() == reflect.Uint8 && x.Kind() == reflect.Slice && x.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(x.Bytes())
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), x.Len(), x.Len())
+		for i := 0; i < x.Len(); i++ {
+			if err := setRecordValue(s.Index(i), x.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %v", i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && x.Kind() == reflect.String:
+		v.SetBytes([]byte(x.String()))
+		return nil
+	case v.Kind() == reflect.String && x.Kind() == reflect.Slice && x.Type().Elem().Kind() == reflect.Uint8:
+		v.SetString(string(x.Bytes()))
+		return nil
+	case v.Kind() == reflect.Bool || x.Kind() == reflect.Bool || v.Kind() == reflect.String || x.Kind() == reflect.String:
+	case x.Type().ConvertibleTo(v.Type()):
+		c := x.Convert(v.Type())
+		// refuse values that don't survive the conversion, like 256 in a uint8
+		if back := c.Convert(x.Type()); back.Interface() != x.Interface() {
+			return fmt.Errorf("%v does not fit in %v", x.Interface(), v.Type())
+		}
+		v.Set(c)
+		return nil
+	}
+	return fmt.Errorf("can't use %v as %v", x.Type(), v.Type())
+}
+
+// record converts an unpacked struct to a Record.
+func (f *Format) record(v reflect.Value) Record {
+	rec := make(Record, len(f.fields))
+	for _, field := range f.fields {
+		if field.pad {
+			continue
+		}
+		fv := v.FieldByName(field.goName)
+		if field.sub == nil {
+			rec[field.name] = fv.Interface()
+		} else if fv.Kind() == reflect.Struct {
+			rec[field.name] = field.sub.record(fv)
+		} else {
+			recs := make([]Record, fv.Len())
+			for i := range recs {
+				recs[i] = field.sub.record(fv.Index(i))
+			}
+			rec[field.name] = recs
+		}
+	}
+	return rec
+}
@@ -0,0 +1,143 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordPoint struct {
+	X, Y int16
+}
+
+type recordStatic struct {
+	Flags  uint8 `struc:"uint8:4"`
+	Mode   uint8 `struc:"uint8:4"`
+	Len    int   `struc:"uint16,little,sizeof=Data"`
+	Data   []byte
+	Name   string `struc:"[6]cstring"`
+	Ext    uint32 `struc:"if=Flags&1"`
+	Count  int    `struc:"uvarint,sizeof=Points"`
+	Points []recordPoint
+	Pad    []byte  `struc:"[2]pad"`
+	Tag    string  `struc:"[4]byte"`
+	Vals   []int32 `struc:"[3]int32"`
+	CRC    uint16  `struc:"checksum=crc16,range=Flags:Vals"`
+}
+
+func recordFormat() *Format {
+	point := NewFormat().Field("x", "int16").Field("y", "int16")
+	return NewFormat().
+		Field("flags", "uint8:4").
+		Field("mode", "uint8:4").
+		Field("len", "uint16,little,sizeof=data").
+		Field("data", "[]byte").
+		Field("name", "[6]cstring").
+		Field("ext", "uint32,if=flags&1").
+		Field("count", "uvarint,sizeof=points").
+		Struct("points", "[]", point).
+		Field("pad", "[2]pad").
+		Field("tag", "[4]string").
+		Field("vals", "[3]int32").
+		Field("crc", "uint16,checksum=crc16,range=flags:vals")
+}
+
+func TestFormatMatchesStruct(t *testing.T) {
+	static := &recordStatic{
+		Flags: 1, Mode: 2, Data: []byte("abc"), Name: "hello", Ext: 7,
+		Points: []recordPoint{{1, 2}, {3, 4}}, Tag: "tag!", Vals: []int32{5, 6, 7},
+	}
+	var want bytes.Buffer
+	if err := Pack(&want, static); err != nil {
+		t.Fatal(err)
+	}
+	rec := Record{
+		"flags": 1, "mode": 2, "data": []byte("abc"), "name": "hello", "ext": 7,
+		"points": []Record{{"x": 1, "y": 2}, {"x": 3, "y": 4}},
+		"tag":    "tag!", "vals": []interface{}{5.0, 6, int8(7)},
+	}
+	f := recordFormat()
+	var got bytes.Buffer
+	if err := f.Pack(&got, rec, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("got % x, want % x", got.Bytes(), want.Bytes())
+	}
+	if size, err := f.Sizeof(rec, nil); err != nil || size != want.Len() {
+		t.Fatalf("Sizeof: %d, %v", size, err)
+	}
+
+	out, err := f.Unpack(&got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRec := Record{
+		"flags": uint8(1), "mode": uint8(2), "len": uint16(3), "data": []byte("abc"),
+		"name": "hello", "ext": uint32(7), "count": uint64(2),
+		"points": []Record{{"x": int16(1), "y": int16(2)}, {"x": int16(3), "y": int16(4)}},
+		"tag":    "tag!", "vals": []int32{5, 6, 7}, "crc": out["crc"],
+	}
+	if !reflect.DeepEqual(out, wantRec) {
+		t.Fatalf("got %#v, want %#v", out, wantRec)
+	}
+	var static2 recordStatic
+	if err := Unpack(bytes.NewReader(want.Bytes()), &static2); err != nil {
+		t.Fatal(err)
+	}
+	if uint16(static2.CRC) != out["crc"].(uint16) {
+		t.Fatalf("crc %#x, want %#x", out["crc"], static2.CRC)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	f := NewFormat().Field("len", "uint8,sizeof=data").Field("data", "[]int16")
+	_, err := f.Unpack(bytes.NewReader([]byte{2, 0, 1, 0}), nil)
+	if fe, ok := err.(*FieldError); !ok || fe.Path != "data" {
+		t.Fatalf("got %v", err)
+	}
+	tests := []struct {
+		f   *Format
+		rec Record
+		err string
+	}{
+		{f, Record{"data": []int{70000}}, "does not fit"},
+		{f, Record{"data": []int{1.0}, "other": 1}, "other is not in the Format"},
+		{f, Record{"data": "x"}, "can't use string"},
+		{NewFormat().Field("a b", "int8"), nil, "invalid Format field name"},
+		{NewFormat().Field("a", "int8").Field("A", "int8"), nil, "collide"},
+		{NewFormat().Field("a", "int12"), nil, "unknown type"},
+		{NewFormat().Field("a", "sizeof=b"), nil, "no type"},
+		{NewFormat().Field("a", "int8,sizeof=b"), nil, "`sizeof=b` field does not exist"},
+		{NewFormat(), nil, "no fields"},
+	}
+	for _, test := range tests {
+		err := test.f.Pack(&bytes.Buffer{}, test.rec, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error containing %q, got %v", test.err, err)
+		}
+	}
+	// nested errors are wrapped once, with Format names and no Go type
+	nested := NewFormat().Field("n", "uint8,sizeof=items").Struct("items", "[]", NewFormat().Field("x", "int16"))
+	err = nested.Pack(&bytes.Buffer{}, Record{"items": []Record{{"x": 1.5}}}, nil)
+	if err == nil || err.Error() != "struc: Record field items[0].x: 1.5 does not fit in int16" {
+		t.Errorf("got %v", err)
+	}
+	_, err = nested.Unpack(bytes.NewReader([]byte{1, 0}), nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "struc: items[0].x (offset 1):") {
+		t.Errorf("got %v", err)
+	}
+	var out bytes.Buffer
+	nested.Dump(&out, bytes.NewReader([]byte{1, 0, 2}), nil)
+	if s := out.String(); !strings.Contains(s, "n = 1") || !strings.Contains(s, "items[0].x = 2") {
+		t.Errorf("dump uses Go names:\n%s", s)
+	}
+	// an indirect cycle must fail rather than deadlock
+	a, b := NewFormat().Field("n", "int8"), NewFormat().Field("n", "int8")
+	a.Struct("b", "", b)
+	b.Struct("a", "[2]", a)
+	if _, err := a.Type(); err == nil || !strings.Contains(err.Error(), "contains its own Format") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package struc
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+)
+
+// typeCache remembers the Packer of the last struct type packed or unpacked
+// by an Encoder or Decoder, skipping the global field cache for streams of
+// identical records.
+type typeCache struct {
+	typ    reflect.Type
+	packer Packer
+}
+
+func (c *typeCache) prep(data interface{}) (reflect.Value, Packer, error) {
+	if typ := reflect.TypeOf(data); typ != nil && typ == c.typ {
+		value := reflect.ValueOf(data)
+		for value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.Struct {
+			return value, c.packer, nil
+		}
+	}
+	val, packer, err := prep(data)
+	if err == nil && val.Kind() == reflect.Struct {
+		c.typ = reflect.TypeOf(data)
+		c.packer = packer
+	}
+	return val, packer, err
+}
+
+// A Decoder reads a stream of packed values from an io.Reader.
+// It buffers its input, so it may read past the last value it decodes.
+type Decoder struct {
+	r       *reader
+	options Options
+	err     error
+	cache   typeCache
+}
+
+// NewDecoder returns a Decoder reading from r. A nil options uses the
+// defaults, as with UnpackWithOptions.
+func NewDecoder(r io.Reader, options *Options) *Decoder {
+	d := &Decoder{r: &reader{r: bufio.NewReader(r)}}
+	if options != nil {
+		d.options = *options
+	}
+	d.err = d.options.Validate()
+	return d
+}
+
+// Decode unpacks the next value from the stream into data. It returns io.EOF
+// if the stream ended cleanly before the value.
+func (d *Decoder) Decode(data interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+	val, packer, err := d.cache.prep(data)
+	if err != nil {
+		return err
+	}
+	start := d.r.off
+	d.r.limit(&d.options)
+	err = packer.Unpack(d.r, val, &d.options)
+	return eofError(err, d.r.off != start)
+}
+
+// Offset returns the number of bytes consumed by the values decoded so far.
+func (d *Decoder) Offset() int64 {
+	return d.r.off
+}
+
+// An Encoder writes a stream of packed values to an io.Writer, reusing one
+// buffer for every value.
+type Encoder struct {
+	w       io.Writer
+	options Options
+	err     error
+	buf     []byte
+	off     int64
+	cache   typeCache
+}
+
+// NewEncoder returns an Encoder writing to w. A nil options uses the
+// defaults, as with PackWithOptions.
+func NewEncoder(w io.Writer, options *Options) *Encoder {
+	e := &Encoder{w: w}
+	if options != nil {
+		e.options = *options
+	}
+	e.err = e.options.Validate()
+	return e
+}
+
+// Encode packs data and writes it to the stream with a single Write call.
+func (e *Encoder) Encode(data interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	val, packer, err := e.cache.prep(data)
+	if err != nil {
+		return err
+	}
+	val = packable(val)
+	size, err := packer.Sizeof(val, &e.options)
+	if err != nil {
+		return err
+	}
+	if cap(e.buf) < size {
+		e.buf = make([]byte, size)
+	}
+	buf := e.buf[:size]
+	for i := range buf {
+		buf[i] = 0
+	}
+	if _, err := packer.Pack(buf, val, &e.options); err != nil {
+		return err
+	}
+	n, err := e.w.Write(buf)
+	e.off += int64(n)
+	return err
+}
+
+// Offset returns the number of bytes written so far.
+func (e *Encoder) Offset() int64 {
+	return e.off
+}
@@ -0,0 +1,66 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, nil)
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(reference); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if enc.Offset() != int64(3*len(referenceBytes)) {
+		t.Fatalf("bad encoder offset: %d", enc.Offset())
+	}
+	if !bytes.Equal(buf.Bytes(), bytes.Repeat(referenceBytes, 3)) {
+		t.Fatal("encoder output differs from Pack")
+	}
+	dec := NewDecoder(&buf, nil)
+	for i := 0; i < 3; i++ {
+		out := &Example{}
+		if err := dec.Decode(out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(reference, out) {
+			t.Fatalf("got: %#v\nwant: %#v", out, reference)
+		}
+		if dec.Offset() != int64((i+1)*len(referenceBytes)) {
+			t.Fatalf("bad decoder offset: %d", dec.Offset())
+		}
+	}
+	if err := dec.Decode(&Example{}); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader(referenceBytes[:20]), nil)
+	if err := dec.Decode(&Example{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, &Options{Order: binary.LittleEndian})
+	if err := enc.Encode(&ExampleEndian{1}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{1, 0}) {
+		t.Fatalf("got: %#v", buf.Bytes())
+	}
+	if err := NewEncoder(&buf, &Options{PtrSize: 7}).Encode(&ExampleEndian{}); err == nil {
+		t.Fatal("failed to error on invalid options")
+	}
+	if err := NewDecoder(&buf, &Options{PtrSize: 7}).Decode(&ExampleEndian{}); err == nil {
+		t.Fatal("failed to error on invalid options")
+	}
+}
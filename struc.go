@@ -9,13 +9,31 @@ import (
 
 type Options struct {
 	ByteAlign int
-	PtrSize   int
+	PtrSize   int // defaults to 32, or the pointer size of CABI
 	Order     binary.ByteOrder
+
+	// CABI pads fields to their natural alignment and structs to a multiple
+	// of their alignment, matching unpacked C structs on that ABI.
+	CABI ABI
+
+	// Limits enforced by Unpack against hostile input, 0 means unlimited
+	// unless noted.
+	MaxSliceLen   int // longest slice or string length read from the input
+	MaxTotalBytes int // most bytes consumed by a single Unpack
+	MaxDepth      int // deepest struct nesting, counting the outer struct; 0 means DefaultMaxDepth
 }
 
 func (o *Options) Validate() error {
+	switch o.CABI {
+	case ABINone, ABIAmd64, ABI386, ABIArm, ABIArm64:
+	default:
+		return fmt.Errorf("Invalid Options.CABI: %d", o.CABI)
+	}
+	if o.CABI != ABINone && o.ByteAlign != 0 {
+		return fmt.Errorf("Invalid Options: ByteAlign and CABI can't be combined")
+	}
 	if o.PtrSize == 0 {
-		o.PtrSize = 32
+		o.PtrSize = o.CABI.ptrSize()
 	} else {
 		switch o.PtrSize {
 		case 8, 16, 32, 64:
@@ -23,6 +41,9 @@ func (o *Options) Validate() error {
 			return fmt.Errorf("Invalid Options.PtrSize: %d. Must be in (8, 16, 32, 64)", o.PtrSize)
 		}
 	}
+	if o.MaxSliceLen < 0 || o.MaxTotalBytes < 0 || o.MaxDepth < 0 {
+		return fmt.Errorf("Invalid Options limits: must not be negative")
+	}
 	return nil
 }
 
@@ -46,6 +67,9 @@ func prep(data interface{}) (reflect.Value, Packer, error) {
 	switch value.Kind() {
 	case reflect.Struct:
 		fields, err := parseFields(value)
+		if err == nil && reflect.PtrTo(value.Type()).Implements(generatedType) {
+			return value, generatedPacker{fields}, nil
+		}
 		return value, fields, err
 	default:
 		if !value.IsValid() {
@@ -58,6 +82,30 @@ func prep(data interface{}) (reflect.Value, Packer, error) {
 	}
 }
 
+func prepPack(data interface{}) (reflect.Value, Packer, error) {
+	val, packer, err := prep(data)
+	if err != nil {
+		return val, nil, err
+	}
+	return packable(val), packer, nil
+}
+
+// packable converts strings to []byte and copies structs passed by value,
+// as Custom fields are packed through pointers.
+func packable(val reflect.Value) reflect.Value {
+	switch val.Kind() {
+	case reflect.String:
+		return val.Convert(reflect.TypeOf([]byte{}))
+	case reflect.Struct:
+		if !val.CanAddr() {
+			tmp := reflect.New(val.Type()).Elem()
+			tmp.Set(val)
+			return tmp
+		}
+	}
+	return val
+}
+
 func Pack(w io.Writer, data interface{}) error {
 	return PackWithOptions(w, data, nil)
 }
@@ -69,14 +117,18 @@ func PackWithOptions(w io.Writer, data interface{}, options *Options) error {
 	if err := options.Validate(); err != nil {
 		return err
 	}
-	val, packer, err := prep(data)
+	val, packer, err := prepPack(data)
 	if err != nil {
 		return err
 	}
-	if val.Type().Kind() == reflect.String {
-		val = val.Convert(reflect.TypeOf([]byte{}))
+	return pack(w, val, packer, options)
+}
+
+func pack(w io.Writer, val reflect.Value, packer Packer, options *Options) error {
+	size, err := packer.Sizeof(val, options)
+	if err != nil {
+		return err
 	}
-	size := packer.Sizeof(val, options)
 	buf := make([]byte, size)
 	if _, err := packer.Pack(buf, val, options); err != nil {
 		return err
@@ -85,10 +137,116 @@ func PackWithOptions(w io.Writer, data interface{}, options *Options) error {
 	return err
 }
 
+// PackInto packs data into the start of buf, returning the number of bytes
+// written, or io.ErrShortBuffer if buf is too small.
+func PackInto(buf []byte, data interface{}) (int, error) {
+	return PackIntoWithOptions(buf, data, nil)
+}
+
+func PackIntoWithOptions(buf []byte, data interface{}, options *Options) (int, error) {
+	if options == nil {
+		options = emptyOptions
+	}
+	if err := options.Validate(); err != nil {
+		return 0, err
+	}
+	val, packer, err := prepPack(data)
+	if err != nil {
+		return 0, err
+	}
+	return packInto(buf, val, packer, options)
+}
+
+func packInto(buf []byte, val reflect.Value, packer Packer, options *Options) (int, error) {
+	size, err := packer.Sizeof(val, options)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < size {
+		return 0, io.ErrShortBuffer
+	}
+	buf = buf[:size]
+	for i := range buf {
+		buf[i] = 0
+	}
+	if _, err := packer.Pack(buf, val, options); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// AppendPack appends the packed form of data to dst and returns the
+// extended buffer.
+func AppendPack(dst []byte, data interface{}) ([]byte, error) {
+	return AppendPackWithOptions(dst, data, nil)
+}
+
+func AppendPackWithOptions(dst []byte, data interface{}, options *Options) ([]byte, error) {
+	if options == nil {
+		options = emptyOptions
+	}
+	if err := options.Validate(); err != nil {
+		return dst, err
+	}
+	val, packer, err := prepPack(data)
+	if err != nil {
+		return dst, err
+	}
+	return appendPack(dst, val, packer, options)
+}
+
+func appendPack(dst []byte, val reflect.Value, packer Packer, options *Options) ([]byte, error) {
+	size, err := packer.Sizeof(val, options)
+	if err != nil {
+		return dst, err
+	}
+	start := len(dst)
+	if cap(dst)-start < size {
+		tmp := make([]byte, start, 2*cap(dst)+size)
+		copy(tmp, dst)
+		dst = tmp
+	}
+	buf := dst[start : start+size]
+	for i := range buf {
+		buf[i] = 0
+	}
+	if _, err := packer.Pack(buf, val, options); err != nil {
+		return dst[:start], err
+	}
+	return dst[:start+size], nil
+}
+
 func Unpack(r io.Reader, data interface{}) error {
 	return UnpackWithOptions(r, data, nil)
 }
 
+// UnpackBytes unpacks data directly from buf, returning the number of bytes
+// consumed.
+func UnpackBytes(buf []byte, data interface{}) (int, error) {
+	return UnpackBytesWithOptions(buf, data, nil)
+}
+
+func UnpackBytesWithOptions(buf []byte, data interface{}, options *Options) (int, error) {
+	if options == nil {
+		options = emptyOptions
+	}
+	if err := options.Validate(); err != nil {
+		return 0, err
+	}
+	val, packer, err := prep(data)
+	if err != nil {
+		return 0, err
+	}
+	return unpackBytes(buf, val, packer, options)
+}
+
+func unpackBytes(buf []byte, val reflect.Value, packer Packer, options *Options) (int, error) {
+	r := &reader{buf: buf}
+	r.limit(options)
+	err := packer.Unpack(r, val, options)
+	return int(r.off), eofError(err, r.off > 0)
+}
+
 func UnpackWithOptions(r io.Reader, data interface{}, options *Options) error {
 	if options == nil {
 		options = emptyOptions
@@ -100,7 +258,14 @@ func UnpackWithOptions(r io.Reader, data interface{}, options *Options) error {
 	if err != nil {
 		return err
 	}
-	return packer.Unpack(r, val, options)
+	return unpack(r, val, packer, options)
+}
+
+func unpack(r io.Reader, val reflect.Value, packer Packer, options *Options) error {
+	rd := &reader{r: r}
+	rd.limit(options)
+	err := packer.Unpack(rd, val, options)
+	return eofError(err, rd.off > 0)
 }
 
 func Sizeof(data interface{}) (int, error) {
@@ -114,9 +279,9 @@ func SizeofWithOptions(data interface{}, options *Options) (int, error) {
 	if err := options.Validate(); err != nil {
 		return 0, err
 	}
-	val, packer, err := prep(data)
+	val, packer, err := prepPack(data)
 	if err != nil {
 		return 0, err
 	}
-	return packer.Sizeof(val, options), nil
+	return packer.Sizeof(val, options)
 }
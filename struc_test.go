@@ -3,7 +3,9 @@ package struc
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
 )
@@ -308,3 +310,64 @@ func TestSliceUnderrun(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUnpackBytes(t *testing.T) {
+	buf := append(append([]byte{}, referenceBytes...), 0xff, 0xff)
+	out := &Example{}
+	n, err := UnpackBytes(buf, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(referenceBytes) {
+		t.Fatalf("expected %d bytes consumed, got %d", len(referenceBytes), n)
+	}
+	if !reflect.DeepEqual(reference, out) {
+		t.Fatalf("got: %#v\nwant: %#v", out, reference)
+	}
+	// unpacked values must not alias the input
+	for i := range buf {
+		buf[i] = 0
+	}
+	if !reflect.DeepEqual(reference, out) {
+		t.Fatal("unpacked value aliases input buffer")
+	}
+	if _, err := UnpackBytes(referenceBytes[:10], &Example{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestPackInto(t *testing.T) {
+	buf := bytes.Repeat([]byte{0xff}, len(referenceBytes)+2)
+	n, err := PackInto(buf, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(referenceBytes) {
+		t.Fatalf("expected %d bytes written, got %d", len(referenceBytes), n)
+	}
+	if !bytes.Equal(buf[:n], referenceBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf[:n], referenceBytes)
+	}
+	if _, err := PackInto(buf[:10], reference); err != io.ErrShortBuffer {
+		t.Fatalf("expected io.ErrShortBuffer, got %v", err)
+	}
+}
+
+func TestAppendPack(t *testing.T) {
+	prefix := []byte("prefix")
+	out, err := AppendPack(prefix, reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte("prefix"), referenceBytes...)
+	if !bytes.Equal(out, want) {
+		t.Fatalf("got: %#v\nwant: %#v", out, want)
+	}
+	out, err = AppendPack(out[:0], &ExampleEndian{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte{0, 1}) {
+		t.Fatalf("got: %#v", out)
+	}
+}
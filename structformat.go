@@ -0,0 +1,331 @@
+package struc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// A StructFormat is a Python struct module format string, such as "<IHH8s",
+// compiled to a Go struct type with one field per value.
+//
+// The first character may select the byte order, size and alignment: '@'
+// (the default) uses native order, sizes and alignment, '=' native order and
+// standard sizes, '<' little-endian, and '>' or '!' big-endian, all with
+// standard sizes and no alignment. Codes may be preceded by a repeat count,
+// which is the length for 's' and 'p'; a count of 0 only aligns. Values are packed from and unpacked
+// to Go types: 'c' is a byte, '?' a bool, integers and 'f' and 'd' the Go
+// type of their size, 'e' a float64, and 's' and 'p' a []byte.
+type StructFormat struct {
+	format  string
+	items   []structItem
+	typ     reflect.Type
+	fields  Fields
+	options Options
+}
+
+type structItem struct {
+	code  byte
+	field int // index in the struct
+	len   int // of an 's' or 'p' item
+}
+
+// structCodes maps format codes with standard sizes to struc types.
+var structCodes = map[byte]string{
+	'x': "pad",
+	'c': "uint8",
+	'b': "int8",
+	'B': "uint8",
+	'?': "bool",
+	'h': "int16",
+	'H': "uint16",
+	'i': "int32",
+	'I': "uint32",
+	'l': "int32",
+	'L': "uint32",
+	'q': "int64",
+	'Q': "uint64",
+	'e': "float16",
+	'f': "float32",
+	'd': "float64",
+	's': "byte",
+	'p': "byte",
+}
+
+var structGoTypes = map[string]reflect.Type{
+	"float16": reflect.TypeOf(Float16(0)),
+	"byte":    reflect.TypeOf([]byte(nil)),
+	"pad":     reflect.TypeOf([]byte(nil)),
+}
+
+// nativeOrder returns the byte order of the host.
+func nativeOrder() binary.ByteOrder {
+	switch runtime.GOARCH {
+	case "mips", "mips64", "ppc64", "s390x", "sparc64":
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// nativeCode returns the struc type of an integer code with its native size,
+// for codes whose size is the platform's.
+func nativeCode(code byte) (string, bool) {
+	ptr := strconv.Itoa(strconv.IntSize)
+	long := ptr
+	if runtime.GOOS == "windows" {
+		long = "32"
+	}
+	switch code {
+	case 'l', 'n':
+		if code == 'n' {
+			return "int" + ptr, true
+		}
+		return "int" + long, true
+	case 'L':
+		return "uint" + long, true
+	case 'N', 'P':
+		return "uint" + ptr, true
+	}
+	return "", false
+}
+
+// ParseStructFormat compiles a Python struct format string.
+func ParseStructFormat(format string) (*StructFormat, error) {
+	s := &StructFormat{format: format}
+	native := true
+	s.options.Order = nativeOrder()
+	rest := format
+	if len(rest) > 0 {
+		switch rest[0] {
+		case '@':
+		case '=':
+			native = false
+		case '<':
+			native, s.options.Order = false, binary.LittleEndian
+		case '>', '!':
+			native, s.options.Order = false, binary.BigEndian
+		default:
+			rest = "@" + rest
+		}
+		rest = rest[1:]
+	}
+	var fields []reflect.StructField
+	add := func(name, tag string, typ reflect.Type) {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("%s%d", name, len(fields)),
+			Type: typ,
+			Tag:  reflect.StructTag("struc:" + strconv.Quote(tag)),
+		})
+	}
+	hostABI := ABIAmd64
+	if runtime.GOARCH == "386" {
+		hostABI = ABI386
+	}
+	for i := 0; i < len(rest); {
+		c := rest[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		count := 1
+		if c >= '0' && c <= '9' {
+			j := i
+			for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(rest[i:j])
+			if err != nil || j == len(rest) {
+				return nil, fmt.Errorf("struc: format %q has a repeat count without a code", format)
+			}
+			count, i, c = n, j, rest[j]
+		}
+		i++
+		typ, ok := structCodes[c]
+		if native {
+			if t, ok2 := nativeCode(c); ok2 {
+				typ, ok = t, true
+			}
+		}
+		if !ok {
+			if c == 'n' || c == 'N' || c == 'P' {
+				return nil, fmt.Errorf("struc: format %q uses '%c' without native sizes", format, c)
+			}
+			return nil, fmt.Errorf("struc: format %q has unknown code '%c'", format, c)
+		}
+		goType, ok := structGoTypes[typ]
+		if !ok {
+			goType = formatGoTypes[typeLookup[typ]]
+		}
+		switch c {
+		case 'x':
+			if count > 0 {
+				add("Pad", fmt.Sprintf("[%d]pad", count), goType)
+			}
+		case 's':
+			s.items = append(s.items, structItem{code: c, field: len(fields), len: count})
+			add("F", fmt.Sprintf("[%d]byte", count), goType)
+		case 'p':
+			s.items = append(s.items, structItem{code: c, field: len(fields), len: count})
+			if count > 0 {
+				add("Len", "uint8", formatGoTypes[Uint8])
+				add("F", fmt.Sprintf("[%d]byte", count-1), goType)
+			}
+		default:
+			var opts []string
+			size := 2 // float16
+			if t, ok := typeLookup[typ]; ok {
+				size = t.Size()
+				opts = append(opts, typ)
+			}
+			if align := hostABI.alignOf(size); native && align > 1 {
+				opts = append(opts, "align="+strconv.Itoa(align))
+				if count == 0 {
+					// a zero count only aligns, which pads the end of a struct
+					add("Pad", "[0]pad,align="+strconv.Itoa(align), structGoTypes["pad"])
+				}
+			}
+			tag := strings.Join(opts, ",")
+			for k := 0; k < count; k++ {
+				s.items = append(s.items, structItem{code: c, field: len(fields)})
+				add("F", tag, goType)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		fields = append(fields, reflect.StructField{Name: "Pad0", Type: reflect.TypeOf([0]byte{})})
+	}
+	s.typ = reflect.StructOf(fields)
+	var err error
+	if s.fields, err = parseFields(reflect.New(s.typ)); err != nil {
+		return nil, fmt.Errorf("struc: format %q: %v", format, err)
+	}
+	return s, nil
+}
+
+// Type returns the Go struct type of the format.
+func (s *StructFormat) Type() reflect.Type {
+	return s.typ
+}
+
+// Fields returns the struc schema of the format's struct type.
+func (s *StructFormat) Fields() Fields {
+	return s.fields
+}
+
+// Options returns the Options the format packs with, which hold its byte
+// order.
+func (s *StructFormat) Options() *Options {
+	options := s.options
+	return &options
+}
+
+// Size returns the packed size of the format, like Python's struct.calcsize.
+func (s *StructFormat) Size() int {
+	n, _ := SizeofWithOptions(reflect.New(s.typ).Interface(), s.Options())
+	return n
+}
+
+// Pack packs one argument per value of the format.
+func (s *StructFormat) Pack(w io.Writer, args ...interface{}) error {
+	if len(args) != len(s.items) {
+		return fmt.Errorf("struc: format %q takes %d arguments, got %d", s.format, len(s.items), len(args))
+	}
+	v := reflect.New(s.typ)
+	for i, item := range s.items {
+		f := v.Elem().Field(item.field)
+		if item.code != 's' && item.code != 'p' {
+			arg := args[i]
+			if b, ok := arg.([]byte); ok && item.code == 'c' && len(b) == 1 {
+				arg = b[0]
+			}
+			if err := setRecordValue(f, reflect.ValueOf(arg)); err != nil {
+				return fmt.Errorf("struc: format argument %d: %v", i, err)
+			}
+			continue
+		}
+		var b []byte
+		switch arg := args[i].(type) {
+		case []byte:
+			b = arg
+		case string:
+			b = []byte(arg)
+		default:
+			return fmt.Errorf("struc: format argument %d: can't use %T as []byte", i, arg)
+		}
+		n := item.len
+		if item.code == 'p' {
+			if n == 0 {
+				continue
+			}
+			n--
+			length := len(b)
+			if length > n {
+				length = n
+			}
+			if length > 255 {
+				length = 255
+			}
+			f.SetUint(uint64(length))
+			f = v.Elem().Field(item.field + 1)
+		}
+		buf := make([]byte, n)
+		copy(buf, b)
+		f.SetBytes(buf)
+	}
+	return PackWithOptions(w, v.Interface(), s.Options())
+}
+
+// Unpack unpacks the values of the format from r.
+func (s *StructFormat) Unpack(r io.Reader) ([]interface{}, error) {
+	v := reflect.New(s.typ)
+	if err := UnpackWithOptions(r, v.Interface(), s.Options()); err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(s.items))
+	for i, item := range s.items {
+		f := v.Elem().Field(item.field)
+		switch item.code {
+		case 'e':
+			out[i] = float64(f.Interface().(Float16))
+		case 's':
+			out[i] = append([]byte{}, f.Bytes()...)
+		case 'p':
+			if item.len == 0 {
+				out[i] = []byte{}
+				continue
+			}
+			data := v.Elem().Field(item.field + 1).Bytes()
+			n := int(f.Uint())
+			if n > len(data) {
+				n = len(data)
+			}
+			out[i] = append([]byte{}, data[:n]...)
+		default:
+			out[i] = f.Interface()
+		}
+	}
+	return out, nil
+}
+
+// PackFormat packs args to w as described by a Python struct format string.
+func PackFormat(w io.Writer, format string, args ...interface{}) error {
+	s, err := ParseStructFormat(format)
+	if err != nil {
+		return err
+	}
+	return s.Pack(w, args...)
+}
+
+// UnpackFormat unpacks values from r as described by a Python struct format
+// string.
+func UnpackFormat(r io.Reader, format string) ([]interface{}, error) {
+	s, err := ParseStructFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return s.Unpack(r)
+}
@@ -0,0 +1,110 @@
+package struc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestStructFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		out    []interface{} // unpacked values, if they differ from args
+		hex    string        // from Python's struct.pack
+	}{
+		{"<IHH8s", []interface{}{uint32(1), uint16(2), uint16(3), []byte("abcdefgh")}, nil,
+			"01000000020003006162636465666768"},
+		{">Hbl4p", []interface{}{65535, -128, -5, "hi"},
+			[]interface{}{uint16(65535), int8(-128), int32(-5), []byte("hi")},
+			"ffff80fffffffb02686900"},
+		{"!2h c?", []interface{}{int16(1), int16(-1), []byte("z"), true},
+			[]interface{}{int16(1), int16(-1), byte('z'), true},
+			"0001ffff7a01"},
+		{"=3s2x0s", []interface{}{"abcdef", ""},
+			[]interface{}{[]byte("abc"), []byte{}},
+			"6162630000"},
+		{"@b0i", []interface{}{int8(1)}, nil, "01000000"},
+	}
+	if runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" {
+		tests = append(tests, struct {
+			format string
+			args   []interface{}
+			out    []interface{}
+			hex    string
+		}{"@bhq?e3x2si", []interface{}{-2, 300, 1 << 40, true, 2.5, "abc", 7},
+			[]interface{}{int8(-2), int16(300), int64(1 << 40), true, 2.5, []byte("ab"), int32(7)},
+			"fe002c0100000000000000000001000001000041000000616200000007000000"})
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := PackFormat(&buf, test.format, test.args...); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != test.hex {
+			t.Errorf("%s: packed %s, want %s", test.format, got, test.hex)
+			continue
+		}
+		s, err := ParseStructFormat(test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Size() != buf.Len() {
+			t.Errorf("%s: Size %d, want %d", test.format, s.Size(), buf.Len())
+		}
+		out, err := UnpackFormat(&buf, test.format)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		want := test.out
+		if want == nil {
+			want = test.args
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("%s: unpacked %#v, want %#v", test.format, out, want)
+		}
+	}
+}
+
+func TestStructFormatFields(t *testing.T) {
+	s, err := ParseStructFormat("<hxI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := s.Fields()
+	if len(fields) != 3 || fields[0].Type != Int16 || fields[1].Type != Pad || fields[2].Type != Uint32 {
+		t.Fatalf("fields %v", fields)
+	}
+	if s.Options().Order.String() != "LittleEndian" {
+		t.Fatalf("order %v", s.Options().Order)
+	}
+}
+
+func TestStructFormatErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []interface{}
+		err    string
+	}{
+		{"<hy", nil, "unknown code 'y'"},
+		{"<h3", nil, "repeat count without a code"},
+		{"<P", nil, "without native sizes"},
+		{"<hh", []interface{}{1}, "takes 2 arguments, got 1"},
+		{"<b", []interface{}{200}, "does not fit"},
+		{"<s", []interface{}{1}, "can't use int as []byte"},
+	}
+	for _, test := range tests {
+		err := PackFormat(&bytes.Buffer{}, test.format, test.args...)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.format, test.err, err)
+		}
+	}
+	if _, err := UnpackFormat(bytes.NewReader([]byte{1}), "<h"); err == nil {
+		t.Error("expected an error unpacking a short input")
+	}
+}
@@ -1,7 +1,6 @@
 package struc
 
 import (
-	"fmt"
 	"reflect"
 )
 
@@ -29,8 +28,15 @@ const (
 	SizeType
 	OffType
 	CustomType
+	UnionType
+	CString
+	Uvarint
+	Varint
+	Sleb128
 )
 
+// Resolve converts Size_t and Off_t to a concrete integer type for
+// options.PtrSize, returning Invalid for an unsupported PtrSize.
 func (t Type) Resolve(options *Options) Type {
 	switch t {
 	case OffType:
@@ -43,9 +49,8 @@ func (t Type) Resolve(options *Options) Type {
 			return Int32
 		case 64:
 			return Int64
-		default:
-			panic(fmt.Sprintf("unsupported ptr bits: %d", options.PtrSize))
 		}
+		return Invalid
 	case SizeType:
 		switch options.PtrSize {
 		case 8:
@@ -56,9 +61,8 @@ func (t Type) Resolve(options *Options) Type {
 			return Uint32
 		case 64:
 			return Uint64
-		default:
-			panic(fmt.Sprintf("unsupported ptr bits: %d", options.PtrSize))
 		}
+		return Invalid
 	}
 	return t
 }
@@ -67,11 +71,11 @@ func (t Type) String() string {
 	return typeNames[t]
 }
 
+// Size returns the packed size of a single value of type t, or 0 if t has no
+// fixed size. Size_t and Off_t must be resolved first.
 func (t Type) Size() int {
 	switch t {
-	case SizeType, OffType:
-		panic("Size_t/Off_t types must be converted to another type using options.PtrSize")
-	case Pad, String, Int8, Uint8, Bool:
+	case Pad, String, CString, Int8, Uint8, Bool:
 		return 1
 	case Int16, Uint16:
 		return 2
@@ -79,9 +83,8 @@ func (t Type) Size() int {
 		return 4
 	case Int64, Uint64, Float64:
 		return 8
-	default:
-		panic("Cannot resolve size of type:" + t.String())
 	}
+	return 0
 }
 
 var typeLookup = map[string]Type{
@@ -98,18 +101,32 @@ var typeLookup = map[string]Type{
 	"uint64":  Uint64,
 	"float32": Float32,
 	"float64": Float64,
+	"cstring": CString,
+
+	"uvarint": Uvarint,
+	"varint":  Varint,
+	"leb128":  Uvarint,
+	"uleb128": Uvarint,
+	"sleb128": Sleb128,
 
 	"size_t": SizeType,
 	"off_t":  OffType,
 }
 
 var typeNames = map[Type]string{
+	String:     "string",
+	Struct:     "struct",
+	Ptr:        "ptr",
+	Uvarint:    "uvarint",
 	CustomType: "Custom",
+	UnionType:  "Union",
 }
 
 func init() {
 	for name, enum := range typeLookup {
-		typeNames[enum] = name
+		if _, ok := typeNames[enum]; !ok {
+			typeNames[enum] = name
+		}
 	}
 }
 
@@ -117,20 +134,21 @@ type Size_t uint64
 type Off_t int64
 
 var reflectTypeMap = map[reflect.Kind]Type{
-	reflect.Bool:    Bool,
-	reflect.Int8:    Int8,
-	reflect.Int16:   Int16,
-	reflect.Int:     Int32,
-	reflect.Int32:   Int32,
-	reflect.Int64:   Int64,
-	reflect.Uint8:   Uint8,
-	reflect.Uint16:  Uint16,
-	reflect.Uint:    Uint32,
-	reflect.Uint32:  Uint32,
-	reflect.Uint64:  Uint64,
-	reflect.Float32: Float32,
-	reflect.Float64: Float64,
-	reflect.String:  String,
-	reflect.Struct:  Struct,
-	reflect.Ptr:     Ptr,
+	reflect.Bool:      Bool,
+	reflect.Int8:      Int8,
+	reflect.Int16:     Int16,
+	reflect.Int:       Int32,
+	reflect.Int32:     Int32,
+	reflect.Int64:     Int64,
+	reflect.Uint8:     Uint8,
+	reflect.Uint16:    Uint16,
+	reflect.Uint:      Uint32,
+	reflect.Uint32:    Uint32,
+	reflect.Uint64:    Uint64,
+	reflect.Float32:   Float32,
+	reflect.Float64:   Float64,
+	reflect.String:    String,
+	reflect.Struct:    Struct,
+	reflect.Ptr:       Ptr,
+	reflect.Interface: UnionType,
 }
@@ -6,9 +6,12 @@ import (
 )
 
 func TestBadType(t *testing.T) {
-	defer func() { recover() }()
-	Type(-1).Size()
-	t.Fatal("failed to panic for invalid Type.Size()")
+	if Type(-1).Size() != 0 {
+		t.Fatal("invalid Type.Size() should be 0")
+	}
+	if SizeType.Resolve(&Options{PtrSize: 7}) != Invalid {
+		t.Fatal("failed to reject invalid PtrSize")
+	}
 }
 
 func TestTypeString(t *testing.T) {
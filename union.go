@@ -0,0 +1,141 @@
+package struc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+type unionCase struct {
+	typ reflect.Type // struct type
+	ptr bool         // the interface holds a *typ instead of a typ
+}
+
+type unionCases struct {
+	types map[int64]unionCase
+	keys  map[reflect.Type]int64
+}
+
+var unionRegistry = make(map[reflect.Type]*unionCases)
+var unionLock sync.RWMutex
+
+// RegisterUnion binds discriminator value key to the concrete type of v for
+// struct fields of interface type iface, which must be passed as a nil
+// pointer to the interface:
+//
+//	struc.RegisterUnion((*Body)(nil), 1, &TextBody{})
+//
+// An interface field is tagged with the earlier field holding its
+// discriminator, e.g. `struc:"switch=Kind"`. Unpack allocates the registered
+// type for the decoded discriminator, and Pack writes the discriminator for
+// the type currently stored in the field.
+// RegisterUnion panics on invalid or duplicate registrations.
+func RegisterUnion(iface interface{}, key int64, v interface{}) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		panic("struc: RegisterUnion iface must be a nil pointer to an interface type")
+	}
+	it = it.Elem()
+	vt := reflect.TypeOf(v)
+	if vt == nil || !vt.Implements(it) {
+		panic(fmt.Sprintf("struc: RegisterUnion type %v does not implement %v", vt, it))
+	}
+	c := unionCase{typ: vt}
+	if vt.Kind() == reflect.Ptr {
+		c.typ = vt.Elem()
+		c.ptr = true
+	}
+	if c.typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("struc: RegisterUnion type %v is not a struct", vt))
+	}
+
+	unionLock.Lock()
+	defer unionLock.Unlock()
+	cases, ok := unionRegistry[it]
+	if !ok {
+		cases = &unionCases{
+			types: make(map[int64]unionCase),
+			keys:  make(map[reflect.Type]int64),
+		}
+		unionRegistry[it] = cases
+	}
+	if _, ok := cases.types[key]; ok {
+		panic(fmt.Sprintf("struc: RegisterUnion key %d registered twice for %v", key, it))
+	}
+	if _, ok := cases.keys[vt]; ok {
+		panic(fmt.Sprintf("struc: RegisterUnion type %v registered twice for %v", vt, it))
+	}
+	cases.types[key] = c
+	cases.keys[vt] = key
+}
+
+func unionLookup(it reflect.Type) *unionCases {
+	unionLock.RLock()
+	defer unionLock.RUnlock()
+	return unionRegistry[it]
+}
+
+// unionKey returns the discriminator for the value stored in a union field.
+func unionKey(val reflect.Value) (int64, error) {
+	if val.IsNil() {
+		return 0, fmt.Errorf("union field of type %v is nil", val.Type())
+	}
+	if cases := unionLookup(val.Type()); cases != nil {
+		if key, ok := cases.keys[val.Elem().Type()]; ok {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("type %v is not registered for union %v", val.Elem().Type(), val.Type())
+}
+
+// unionValue returns the addressable struct stored in a union field and its fields.
+func unionValue(val reflect.Value) (reflect.Value, Fields, error) {
+	if _, err := unionKey(val); err != nil {
+		return reflect.Value{}, nil, err
+	}
+	v := val.Elem()
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	} else {
+		tmp := reflect.New(v.Type()).Elem()
+		tmp.Set(v)
+		v = tmp
+	}
+	fields, err := parseFields(v)
+	return v, fields, err
+}
+
+// unpackUnion allocates the type registered for the decoded discriminator
+// and unpacks into it.
+func unpackUnion(r io.Reader, val reflect.Value, disc reflect.Value, options *Options) error {
+	var key int64
+	switch disc.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		key = disc.Int()
+	default:
+		key = int64(disc.Uint())
+	}
+	cases := unionLookup(val.Type())
+	if cases == nil {
+		return fmt.Errorf("no types registered for union %v", val.Type())
+	}
+	c, ok := cases.types[key]
+	if !ok {
+		return fmt.Errorf("unknown discriminator %d for union %v", key, val.Type())
+	}
+	v := reflect.New(c.typ)
+	fields, err := parseFields(v)
+	if err != nil {
+		return err
+	}
+	if err := fields.Unpack(r, v, options); err != nil {
+		return err
+	}
+	if c.ptr {
+		val.Set(v)
+	} else {
+		val.Set(v.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package struc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type unionBody interface {
+	isUnionBody()
+}
+
+type unionText struct {
+	Size int `struc:"uint8,sizeof=Text"`
+	Text string
+}
+
+type unionPoint struct {
+	X, Y int16
+}
+
+func (*unionText) isUnionBody() {}
+func (unionPoint) isUnionBody() {}
+
+func init() {
+	RegisterUnion((*unionBody)(nil), 1, &unionText{})
+	RegisterUnion((*unionBody)(nil), 2, unionPoint{})
+}
+
+type unionTLV struct {
+	Kind uint8
+	Body unionBody `struc:"switch=Kind"`
+	Tail uint8
+}
+
+func TestUnionCodec(t *testing.T) {
+	tests := []struct {
+		val   *unionTLV
+		bytes []byte
+	}{
+		{
+			&unionTLV{Kind: 1, Body: &unionText{Size: 3, Text: "abc"}, Tail: 9},
+			[]byte{1, 3, 'a', 'b', 'c', 9},
+		},
+		{
+			&unionTLV{Kind: 2, Body: unionPoint{X: 1, Y: -1}, Tail: 9},
+			[]byte{2, 0, 1, 0xff, 0xff, 9},
+		},
+	}
+	for _, test := range tests {
+		// the discriminator is filled in by Pack
+		in := *test.val
+		in.Kind = 0
+		size, err := Sizeof(&in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(test.bytes) {
+			t.Fatalf("sizeof failed; expected %d, got %d", len(test.bytes), size)
+		}
+		var buf bytes.Buffer
+		if err := Pack(&buf, &in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.bytes) {
+			t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), test.bytes)
+		}
+		out := &unionTLV{}
+		if err := Unpack(&buf, out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, test.val) {
+			t.Fatalf("got: %#v\nwant: %#v", out, test.val)
+		}
+	}
+}
+
+func TestUnionErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, &unionTLV{}); err == nil {
+		t.Fatal("failed to error on nil union")
+	}
+	if err := Unpack(bytes.NewReader([]byte{3, 0, 0}), &unionTLV{}); err == nil {
+		t.Fatal("failed to error on unknown discriminator")
+	}
+}
+
+type unionNoSwitch struct {
+	Body unionBody
+}
+
+type unionLateSwitch struct {
+	Body unionBody `struc:"switch=Kind"`
+	Kind int
+}
+
+func TestUnionParseErrors(t *testing.T) {
+	if err := parseTest(&unionNoSwitch{}); err == nil {
+		t.Fatal("failed to error on union without switch=")
+	}
+	if err := parseTest(&unionLateSwitch{}); err == nil {
+		t.Fatal("failed to error on switch= after union")
+	}
+}
+
+type unionOptional struct {
+	Has  bool
+	Kind uint8
+	Body unionBody `struc:"switch=Kind,if=Has"`
+}
+
+func TestUnionSkipped(t *testing.T) {
+	// a skipped union packs the discriminator as it is
+	var buf bytes.Buffer
+	if err := Pack(&buf, &unionOptional{Kind: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 7}; !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), want)
+	}
+	out := &unionOptional{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, &unionOptional{Kind: 7}) {
+		t.Fatalf("got: %#v", out)
+	}
+}
@@ -0,0 +1,157 @@
+package struc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var errVarintOverflow = errors.New("varint overflows a 64-bit integer")
+
+// variable reports whether the encoded size of t depends on its value.
+func (t Type) variable() bool {
+	switch t {
+	case Uvarint, Varint, Sleb128:
+		return true
+	}
+	return false
+}
+
+func varintValue(val reflect.Value) uint64 {
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(val.Int())
+	default:
+		return val.Uint()
+	}
+}
+
+func varintSize(typ Type, val reflect.Value) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return packVarint(tmp[:], typ, val)
+}
+
+func packVarint(buf []byte, typ Type, val reflect.Value) int {
+	n := varintValue(val)
+	switch typ {
+	case Varint:
+		return binary.PutVarint(buf, int64(n))
+	case Sleb128:
+		// unsigned values above MaxInt64 round trip through their int64 cast
+		x := int64(n)
+		i := 0
+		for {
+			b := byte(x & 0x7f)
+			x >>= 7
+			if (x == 0 && b&0x40 == 0) || (x == -1 && b&0x40 != 0) {
+				buf[i] = b
+				return i + 1
+			}
+			buf[i] = b | 0x80
+			i++
+		}
+	default:
+		return binary.PutUvarint(buf, n)
+	}
+}
+
+// byteReader adapts an io.Reader for reading a byte at a time.
+type byteReader struct {
+	io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var tmp [1]byte
+	if _, err := io.ReadFull(b.Reader, tmp[:]); err != nil {
+		return 0, err
+	}
+	return tmp[0], nil
+}
+
+func readVarint(r io.ByteReader, typ Type) (uint64, error) {
+	var n uint64
+	var shift uint
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if i == binary.MaxVarintLen64-1 && b > 1 && !(typ == Sleb128 && b == 0x7f) {
+			return 0, errVarintOverflow
+		}
+		n |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			switch typ {
+			case Varint:
+				// zigzag decode
+				n = uint64(int64(n>>1) ^ -int64(n&1))
+			case Sleb128:
+				if shift < 64 && b&0x40 != 0 {
+					n |= ^uint64(0) << shift
+				}
+			}
+			return n, nil
+		}
+	}
+}
+
+func (f *Field) unpackVarint(r io.Reader, val reflect.Value, length int, options *Options) error {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+	typ := f.Type.Resolve(options)
+	if !f.Slice {
+		if f.Ptr {
+			val = val.Elem()
+		}
+		n, err := readVarint(br, typ)
+		if err != nil {
+			return err
+		}
+		setVarint(val, n)
+		return nil
+	}
+	vals := val
+	if val.Kind() == reflect.Slice {
+		vals = makeSlice(val.Type(), val, length)
+	} else if length > val.Len() {
+		return fmt.Errorf("length %d exceeds array length %d", length, val.Len())
+	}
+	for i := 0; i < length; i++ {
+		n, err := readVarint(br, typ)
+		if err != nil {
+			return err
+		}
+		if val.Kind() == reflect.Slice {
+			vals = growSlice(vals, i)
+		}
+		setVarint(vals.Index(i), n)
+	}
+	if val.Kind() == reflect.Slice {
+		val.Set(vals)
+	}
+	return nil
+}
+
+func setVarint(val reflect.Value, n uint64) {
+	switch val.Kind() {
+	case reflect.Bool:
+		val.SetBool(n != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.SetInt(int64(n))
+	default:
+		val.SetUint(n)
+	}
+}
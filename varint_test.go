@@ -0,0 +1,96 @@
+package struc
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type varintExample struct {
+	U    uint64 `struc:"uvarint"`
+	V    int    `struc:"varint"`
+	S    int32  `struc:"sleb128"`
+	L    uint16 `struc:"leb128"`
+	Size int    `struc:"uvarint,sizeof=Data"`
+	Data []byte
+	Arr  []int `struc:"[3]varint"`
+	Tail uint8
+}
+
+func TestVarintCodec(t *testing.T) {
+	ref := &varintExample{
+		U: 300, V: -65, S: -129, L: 127,
+		Size: 200, Data: bytes.Repeat([]byte{'x'}, 200),
+		Arr:  []int{1, -1, 0},
+		Tail: 9,
+	}
+	refBytes := []byte{
+		0xac, 0x02, // 300
+		0x81, 0x01, // zigzag(-65) = 129
+		0xff, 0x7e, // sleb128(-129)
+		0x7f,       // 127
+		0xc8, 0x01, // 200
+	}
+	refBytes = append(refBytes, ref.Data...)
+	refBytes = append(refBytes, 2, 1, 0, 9)
+
+	size, err := Sizeof(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(refBytes) {
+		t.Fatalf("sizeof failed; expected %d, got %d", len(refBytes), size)
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Fatalf("got: %#v\nwant: %#v", buf.Bytes(), refBytes)
+	}
+	out := &varintExample{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, ref) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+type varintLimits struct {
+	U uint64 `struc:"uvarint"`
+	V int64  `struc:"varint"`
+	S int64  `struc:"sleb128"`
+	T int64  `struc:"sleb128"`
+}
+
+func TestVarintLimits(t *testing.T) {
+	ref := &varintLimits{math.MaxUint64, math.MinInt64, math.MinInt64, math.MaxInt64}
+	var buf bytes.Buffer
+	if err := Pack(&buf, ref); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 40 {
+		t.Fatalf("expected 40 bytes, got %d", buf.Len())
+	}
+	out := &varintLimits{}
+	if err := Unpack(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, ref) {
+		t.Fatalf("got: %#v\nwant: %#v", out, ref)
+	}
+}
+
+func TestVarintErrors(t *testing.T) {
+	out := &varintLimits{}
+	overflow := bytes.Repeat([]byte{0xff}, 11)
+	if err := Unpack(bytes.NewReader(overflow), out); !errors.Is(err, errVarintOverflow) {
+		t.Fatalf("expected overflow error, got %v", err)
+	}
+	if err := Unpack(bytes.NewReader([]byte{0x80}), out); err == nil {
+		t.Fatal("failed to error on truncated varint")
+	}
+}